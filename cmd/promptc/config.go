@@ -2,55 +2,528 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/andesdevroot/promptc/internal/cli"
 	"github.com/andesdevroot/promptc/internal/config"
+	"github.com/andesdevroot/promptc/internal/secrets"
+	"github.com/andesdevroot/promptc/pkg/sdk"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
+// settings es la configuración efectiva: defaults, config.yaml, perfil,
+// entorno y --set, en ese orden. settingsLoaded indica si loadSettings ya
+// la resolvió; los subcomandos de config no pasan por ahí.
+var (
+	settings       = config.Defaults()
+	settingsLoaded bool
+)
+
+// configFlags recibe los flags persistentes de rootCmd.
+var configFlags struct {
+	file      string
+	profile   string
+	overrides []string
+}
+
+func addConfigFlags(cmd *cobra.Command) {
+	f := cmd.PersistentFlags()
+	f.StringVar(&configFlags.file, "config", "", "archivo de configuración (env PROMPTC_CONFIG; default ~/.promptc/config.yaml)")
+	f.StringVar(&configFlags.profile, "profile", "", "perfil de configuración: dev, prod, air-gapped o uno de profiles (env PROMPTC_PROFILE)")
+	f.StringArrayVar(&configFlags.overrides, "set", nil, "reemplaza una clave de la configuración, ej: --set limits.workers=4")
+}
+
+// useConfigFile aplica --config o PROMPTC_CONFIG antes de leer el archivo.
+func useConfigFile() {
+	file := configFlags.file
+	if file == "" {
+		file = os.Getenv("PROMPTC_CONFIG")
+	}
+	if file != "" {
+		if expanded, err := expandHome(file); err == nil {
+			file = expanded
+		}
+		config.SetPath(file)
+	}
+}
+
+func configOptions() config.Options {
+	return config.Options{Profile: configFlags.profile, Overrides: configFlags.overrides}
+}
+
+// loadSettings resuelve la configuración efectiva; un error detiene el
+// arranque con la lista completa de problemas.
+func loadSettings() error {
+	useConfigFile()
+	cfg, err := config.Resolve(configOptions())
+	if err != nil {
+		return err
+	}
+	settings, settingsLoaded = cfg, true
+	return nil
+}
+
+func profileName() string {
+	if settings.Profile == "" {
+		return "base"
+	}
+	return settings.Profile
+}
+
+// maskSecrets oculta las keys literales de api_key y keys.<proveedor>,
+// también dentro de los perfiles, antes de mostrar la configuración. Las
+// referencias (env:, vault:, ...) no son secretas y se muestran tal cual.
+func maskSecrets(m map[string]interface{}) {
+	for k, v := range m {
+		switch val := v.(type) {
+		case string:
+			if k == "api_key" {
+				m[k] = secrets.Mask(val)
+			}
+		case map[string]interface{}:
+			if k == "keys" {
+				for name, ref := range val {
+					if s, ok := ref.(string); ok {
+						val[name] = secrets.Mask(s)
+					}
+				}
+				continue
+			}
+			maskSecrets(val)
+		}
+	}
+}
+
+// maskValue enmascara el resultado de config get según la clave pedida:
+// api_key, keys.<proveedor> o una sección que las contenga.
+func maskValue(key string, v interface{}) interface{} {
+	parts := strings.Split(key, ".")
+	last, parent := parts[len(parts)-1], ""
+	if len(parts) > 1 {
+		parent = parts[len(parts)-2]
+	}
+	switch val := v.(type) {
+	case string:
+		if last == "api_key" || parent == "keys" {
+			return secrets.Mask(val)
+		}
+	case map[string]interface{}:
+		// El mapa se enmascara en su lugar, con la clave como contexto
+		maskSecrets(map[string]interface{}{last: val})
+	}
+	return v
+}
+
+// setupOptions son los flags de config sin subcomando; el modo interactivo
+// completa la misma estructura con preguntas.
+type setupOptions struct {
+	provider  string
+	host      string
+	port      int
+	model     string
+	timeout   string
+	apiKey    string
+	keyStdin  bool
+	providers []string
+}
+
+var setup setupOptions
+
 var configCmd = &cobra.Command{
 	Use:   "config",
-	Short: "Configura de forma interactiva las credenciales",
-	Run: func(cmd *cobra.Command, args []string) {
-		cli.PrintBanner()
-		cli.PrintSection("⚙️  Configuración de PromptC")
+	Short: "Configura proveedores y credenciales, con flags o de forma interactiva",
+	Long: `Sin subcomando configura un proveedor: con --provider y sus flags, para
+scripts, o con preguntas si no se indica --provider y stdin es una terminal.
+La API key va a la bóveda o al llavero y config.yaml guarda solo la referencia.
+Con get, set, show, validate y test administra config.yaml y sus perfiles.`,
+	Example: `  promptc config --provider ollama --host 100.90.6.101 --model llama3
+  printf '%s' "$KEY" | promptc config --provider gemini --api-key-stdin
+  promptc config --provider openrouter --api-key env:OPENROUTER_API_KEY
+  promptc config test`,
+	Args: cobra.NoArgs,
+	// La configuración puede estar rota: estos comandos son para repararla
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		useConfigFile()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := setup
+		if opts.provider == "" {
+			for _, name := range []string{"host", "port", "model", "timeout", "api-key", "api-key-stdin", "providers"} {
+				if cmd.Flags().Changed(name) {
+					return fmt.Errorf("--%s requiere --provider", name)
+				}
+			}
+			if !stdinIsTerminal() {
+				return errors.New("stdin no es una terminal: indique --provider y sus flags (ver promptc config --help)")
+			}
+			var err error
+			if opts, err = askSetup(); err != nil {
+				return err
+			}
+		} else if opts.keyStdin {
+			if opts.apiKey != "" {
+				return errors.New("--api-key y --api-key-stdin son excluyentes")
+			}
+			key, err := readSecret(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("--api-key-stdin: %w", err)
+			}
+			opts.apiKey = key
+		}
+		return applySetup(opts)
+	},
+}
 
-		reader := bufio.NewReader(os.Stdin)
+// stdinIsTerminal distingue una sesión interactiva de un script o un pipe.
+func stdinIsTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// currentSettings es la configuración efectiva para mostrar los valores
+// actuales como sugerencia; si está rota se parte de los defaults.
+func currentSettings() config.AppConfig {
+	cfg, err := config.Resolve(configOptions())
+	if err != nil {
+		return config.Defaults()
+	}
+	return cfg
+}
 
-		fmt.Println(cli.ColorCyan + "¿Qué proveedor de IA deseas usar?" + cli.ColorReset)
-		fmt.Println("1) Google Gemini")
+// askSetup es el modo interactivo: Enter conserva el valor actual.
+func askSetup() (setupOptions, error) {
+	cli.PrintBanner()
+	cli.PrintSection("⚙️  Configuración de PromptC")
+
+	cur := currentSettings()
+	reader := bufio.NewReader(os.Stdin)
+	closed := false
+	ask := func(question, current string) string {
+		if current != "" {
+			question += fmt.Sprintf(" [%s]", current)
+		}
+		fmt.Println(cli.ColorCyan + question + cli.ColorReset)
 		fmt.Print(cli.ColorYellow + "> " + cli.ColorReset)
+		answer, err := reader.ReadString('\n')
+		if err != nil && answer == "" {
+			// Sin respuesta no se asume el valor actual: no se escribe nada
+			closed = true
+		}
+		if answer = strings.TrimSpace(answer); answer == "" {
+			return current
+		}
+		return answer
+	}
+
+	var opts setupOptions
+	fmt.Println("1) Ollama (nodo local)")
+	fmt.Println("2) Google Gemini")
+	fmt.Println("3) OpenRouter")
+	switch ask("¿Qué proveedor de IA deseas configurar?", "1") {
+	case "1", "ollama":
+		opts.provider = "ollama"
+		opts.host = ask("\n🖥️  Host del nodo Ollama (IP Tailscale):", cur.Ollama.Host)
+		port, err := strconv.Atoi(ask("\n🔌 Puerto:", strconv.Itoa(cur.Ollama.Port)))
+		if err != nil {
+			return opts, fmt.Errorf("puerto inválido: %w", err)
+		}
+		opts.port = port
+		opts.model = ask("\n🧠 Modelo:", cur.Ollama.Model)
+	case "2", "gemini":
+		opts.provider = "gemini"
+		current := ""
+		if len(cur.Gemini.Models) > 0 {
+			current = cur.Gemini.Models[0]
+		}
+		opts.model = ask("\n🧠 Modelo (Enter = selección automática):", current)
+	case "3", "openrouter":
+		opts.provider = "openrouter"
+		opts.model = ask("\n🧠 Modelo:", cur.OpenRouter.Model)
+	default:
+		return opts, errors.New("opción inválida (1, 2 o 3)")
+	}
+
+	question := "\n🔑 API Key, o una referencia como env:GEMINI_API_KEY"
+	if opts.provider == "ollama" {
+		question += " (Enter = sin autenticación)"
+	}
+	opts.apiKey = ask(question+":", "")
+	if closed {
+		return opts, errors.New("la entrada se cerró antes de terminar: no se guardó nada")
+	}
+	return opts, nil
+}
 
-		providerOption, _ := reader.ReadString('\n')
-		providerOption = strings.TrimSpace(providerOption)
+// applySetup traduce las opciones a claves de config.yaml y las escribe de
+// una vez con config.Update: si el resultado no es válido no se escribe nada.
+func applySetup(opts setupOptions) error {
+	p := opts.provider
+	if !slices.Contains(sdk.Providers, p) {
+		return fmt.Errorf("--provider %q no soportado (%s)", p, strings.Join(sdk.Providers, "|"))
+	}
+	if p != "ollama" && (opts.host != "" || opts.port != 0) {
+		return fmt.Errorf("--host y --port solo aplican a ollama")
+	}
+	if p == "gemini" && opts.timeout != "" {
+		return fmt.Errorf("--timeout no aplica a gemini")
+	}
 
-		var provider string
-		switch providerOption {
-		case "1":
-			provider = "gemini"
+	set := map[string]string{"provider": p}
+	if opts.host != "" {
+		set["ollama.host"] = opts.host
+	}
+	if opts.port != 0 {
+		set["ollama.port"] = strconv.Itoa(opts.port)
+	}
+	if opts.model != "" {
+		switch p {
+		case "gemini":
+			// Lista de un modelo: JSON es YAML válido y respeta cualquier carácter
+			set["gemini.models"] = fmt.Sprintf("[%q]", opts.model)
 		default:
-			provider = "gemini"
+			set[p+".model"] = opts.model
 		}
+	}
+	if opts.timeout != "" {
+		set[p+".timeout"] = opts.timeout
+	}
 
-		fmt.Printf("\n🔑 Ingresa tu API Key:\n")
-		fmt.Print(cli.ColorYellow + "> " + cli.ColorReset)
+	cur := currentSettings()
+	if len(opts.providers) > 0 {
+		set["routing.providers"] = "[" + strings.Join(opts.providers, ", ") + "]"
+	} else if !slices.Contains(cur.Routing.Providers, p) {
+		set["routing.providers"] = "[" + strings.Join(append(slices.Clone(cur.Routing.Providers), p), ", ") + "]"
+		cli.PrintInfo(fmt.Sprintf("%s se agrega al final de routing.providers", p))
+	}
+
+	var unset []string
+	if opts.apiKey != "" {
+		ref := opts.apiKey
+		if secrets.Plaintext(ref) {
+			// La bóveda vive en paths.Vault: este comando no pasa por initPaths
+			if err := initPaths(); err != nil {
+				return err
+			}
+			var err error
+			if ref, err = storeKey(p, opts.apiKey); err != nil {
+				return fmt.Errorf("no se pudo guardar la API key: %w", err)
+			}
+			cli.PrintInfo("API key guardada en " + ref)
+		}
+		set["keys."+p] = ref
+		// Una api_key anterior del mismo proveedor queda reemplazada por keys
+		if file, err := config.Load(); err == nil && configFlags.profile == "" &&
+			file.APIKey != "" && (file.Provider == p || file.Provider == "") {
+			unset = append(unset, "api_key")
+		}
+	} else if p != "ollama" && cur.Keys[p] == "" && os.Getenv(keyEnv[p]) == "" &&
+		!(cur.Provider == p && cur.APIKey != "") {
+		cli.PrintWarning(fmt.Sprintf("%s no tiene API key: use --api-key, --api-key-stdin o %s", p, keyEnv[p]))
+	}
 
-		apiKey, _ := reader.ReadString('\n')
-		apiKey = strings.TrimSpace(apiKey)
+	if err := config.Update(configFlags.profile, set, unset); err != nil {
+		return err
+	}
+	path, _ := config.Path()
+	if configFlags.profile != "" {
+		path = fmt.Sprintf("el perfil %s de %s", configFlags.profile, path)
+	}
+	cli.PrintSuccess(fmt.Sprintf("%s configurado en %s", p, path))
+	cli.PrintInfo("Pruebe la conexión con: promptc config test " + p)
+	return nil
+}
 
-		cfg := config.AppConfig{
-			Provider: provider,
-			APIKey:   apiKey,
+var configGetCmd = &cobra.Command{
+	Use:   "get <clave>",
+	Short: "Muestra el valor efectivo de una clave (ej: routing.mode)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		v, err := config.Get(configOptions(), args[0])
+		if err != nil {
+			return err
+		}
+		v = maskValue(args[0], v)
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			out, _ := yaml.Marshal(v)
+			fmt.Print(string(out))
+		default:
+			fmt.Println(v)
 		}
+		return nil
+	},
+}
 
-		config.Save(cfg)
-		cli.PrintSuccess("¡Configuración guardada en ~/.promptc/config.yaml!")
+var configSetCmd = &cobra.Command{
+	Use:   "set <clave> <valor>",
+	Short: "Escribe una clave en config.yaml (en el perfil de --profile si se indica)",
+	Long: `Escribe una clave en config.yaml. El valor se interpreta como YAML:
+4 es entero, [ollama] es lista y 30s es duración. Con --profile la clave se
+escribe en profiles.<perfil>. El archivo no se modifica si el resultado no
+es válido.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.Set(configFlags.profile, args[0], args[1]); err != nil {
+			return err
+		}
+		path, _ := config.Path()
+		target := args[0]
+		if configFlags.profile != "" {
+			target = "profiles." + configFlags.profile + "." + args[0]
+		}
+		cli.PrintSuccess(fmt.Sprintf("%s actualizado en %s", target, path))
+		return nil
+	},
+}
+
+var configShowEffective bool
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Muestra config.yaml, o con --effective la configuración resuelta",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := config.Path()
+		if err != nil {
+			return err
+		}
+		var doc map[string]interface{}
+		if configShowEffective {
+			if doc, err = config.ResolveMap(configOptions()); err != nil {
+				return err
+			}
+			fmt.Printf("# configuración efectiva — archivo %s\n", path)
+			fmt.Println("# capas: defaults < archivo < perfil < entorno < --set")
+		} else {
+			data, err := os.ReadFile(path)
+			if os.IsNotExist(err) {
+				fmt.Printf("# %s no existe: se usan los defaults (ver --effective)\n", path)
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := yaml.Unmarshal(data, &doc); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			fmt.Printf("# %s\n", path)
+		}
+		if doc == nil {
+			return nil
+		}
+		maskSecrets(doc)
+		out, err := yaml.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+		return nil
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Valida config.yaml con el perfil, el entorno y los --set actuales",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Resolve(configOptions())
+		if err != nil {
+			return err
+		}
+		settings = cfg
+		for _, w := range cfg.Warnings() {
+			cli.PrintWarning(w)
+		}
+		profiles, _ := config.ProfileNames()
+		cli.PrintSuccess(fmt.Sprintf("Configuración válida (perfil %s; disponibles: %s)", profileName(), strings.Join(profiles, ", ")))
+		return nil
+	},
+}
+
+var configTestTimeout time.Duration
+
+var configTestCmd = &cobra.Command{
+	Use:   "test [proveedor...]",
+	Short: "Prueba cada proveedor con un prompt mínimo: latencia, modelo y autenticación",
+	Long: `Envía a cada proveedor de routing.providers (o a los indicados) un prompt
+mínimo con la instrucción real, sin reintentos, caché ni presupuestos, e
+informa latencia, modelo y si la API key fue aceptada. Cada proveedor se
+prueba por separado; termina con error si alguno falla.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadSettings(); err != nil {
+			return err
+		}
+		if err := initPaths(); err != nil {
+			return err
+		}
+		names := settings.Routing.Providers
+		if len(args) > 0 {
+			names = args
+		}
+
+		base := sdkConfig()
+		failed := 0
+		fmt.Printf("%-12s %-8s %-12s %10s  %s\n", "PROVEEDOR", "ESTADO", "AUTH", "LATENCIA", "MODELO")
+		for _, name := range names {
+			cfg := base
+			cfg.Providers = []string{name}
+			app, err := sdk.New(cmd.Context(), cfg)
+			if err != nil {
+				failed++
+				fmt.Printf("%-12s %-8s %-12s %10s  %s\n", name, "ERROR", "-", "-", "-")
+				fmt.Printf("  └ %s\n", secrets.Redact(err.Error()))
+				continue
+			}
+			if len(app.Optimizers) == 0 {
+				failed++
+				fmt.Printf("%-12s %-8s %-12s %10s  %s\n", name, "SIN_KEY", "-", "-", "-")
+				if name == "ollama" {
+					fmt.Println("  └ ollama.host no está configurado")
+				} else {
+					fmt.Printf("  └ defina keys.%s o %s\n", name, keyEnv[name])
+				}
+				continue
+			}
+			for _, c := range app.CheckProviders(cmd.Context(), configTestTimeout) {
+				state := "OK"
+				if c.Err != nil {
+					failed++
+					state = "FALLA"
+				}
+				model := c.Model
+				if model == "" {
+					model = "-"
+				}
+				fmt.Printf("%-12s %-8s %-12s %8dms  %s\n", name, state, c.Auth, c.LatencyMs, model)
+				if c.Err != nil {
+					fmt.Printf("  └ %s\n", secrets.Redact(c.Err.Error()))
+				}
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d de %d proveedores fallaron", failed, len(names))
+		}
+		return nil
 	},
 }
 
 func init() {
+	configShowCmd.Flags().BoolVar(&configShowEffective, "effective", false, "resuelve defaults, perfil, entorno y --set")
+	f := configCmd.Flags()
+	f.StringVar(&setup.provider, "provider", "", "proveedor a configurar: "+strings.Join(sdk.Providers, ", "))
+	f.StringVar(&setup.host, "host", "", "host del nodo ollama")
+	f.IntVar(&setup.port, "port", 0, "puerto del nodo ollama")
+	f.StringVar(&setup.model, "model", "", "modelo del proveedor")
+	f.StringVar(&setup.timeout, "timeout", "", "plazo por inferencia, ej: 60s (ollama, openrouter)")
+	f.StringVar(&setup.apiKey, "api-key", "", "API key o referencia (env:, file:, cmd:, keyring:, vault:); una key literal queda visible en el historial del shell")
+	f.BoolVar(&setup.keyStdin, "api-key-stdin", false, "lee la API key de stdin")
+	f.StringSliceVar(&setup.providers, "providers", nil, "reemplaza routing.providers, ej: ollama,gemini")
+	configTestCmd.Flags().DurationVar(&configTestTimeout, "timeout", 60*time.Second, "plazo por proveedor")
+	configCmd.AddCommand(configGetCmd, configSetCmd, configShowCmd, configValidateCmd, configTestCmd)
 	rootCmd.AddCommand(configCmd)
 }
@@ -2,74 +2,191 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 
 	"github.com/andesdevroot/promptc/internal/cli"
-	"github.com/andesdevroot/promptc/internal/config"
-	"github.com/andesdevroot/promptc/internal/parser"
+	"github.com/andesdevroot/promptc/internal/secrets"
+	"github.com/andesdevroot/promptc/pkg/core"
+	"github.com/andesdevroot/promptc/pkg/parser"
 	"github.com/andesdevroot/promptc/pkg/sdk"
 	"github.com/spf13/cobra"
 )
 
+var fixFlags struct {
+	attempts int
+	minScore int
+	write    bool
+	verbose  bool
+}
+
 var fixCmd = &cobra.Command{
 	Use:   "fix [archivo.yaml]",
-	Short: "Analiza y repara un prompt con redundancia de IA",
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		cli.PrintBanner()
-		cfg, _ := config.Load()
-		p, err := parser.ParseFile(args[0])
+	Short: "Analiza y repara un prompt con los proveedores configurados",
+	Long: `Analiza el prompt y, si no alcanza analyzer.min_score, pide a la cadena de
+proveedores una versión corregida. Cada propuesta se aplica al YAML original,
+se vuelve a parsear y se vuelve a puntuar; se repite hasta alcanzar el umbral
+o agotar --attempts, partiendo siempre de la mejor versión obtenida.
+
+Muestra el diff unificado de la mejor versión; --write la escribe en el
+archivo, conservando comentarios, orden de claves e id, version y variables.
+Termina con error si el umbral no se alcanza.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if fixFlags.attempts < 1 {
+			return errors.New("--attempts debe ser al menos 1")
+		}
+		path := args[0]
+		src, err := os.ReadFile(path)
 		if err != nil {
-			fmt.Println("Error:", err)
-			os.Exit(1)
+			return err
+		}
+		p, err := parser.Parse(src)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
 		}
 
-		ctx := context.Background()
-		promptcSDK, _ := sdk.NewSDK(ctx, cfg.APIKey, "")
-
-		analysis := promptcSDK.Analyze(p)
-		
-		analysisResult, ok := analysis.(map[string]interface{})
-		if !ok {
-			fmt.Println("Error: invalid analysis result type")
-			os.Exit(1)
+		// La cadena de proveedores es la del servidor, sin caché: un reintento
+		// sobre el mismo prompt debe volver a consultar al proveedor
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		app, err := sdk.New(ctx, sdkConfig())
+		if err != nil {
+			return errors.New(secrets.Redact(err.Error()))
+		}
+		tuneSDK(app)
+		if fixFlags.minScore > 0 {
+			app.Engine.MinScoreThreshold = fixFlags.minScore
+		}
+		if !fixFlags.verbose {
+			log.SetOutput(io.Discard)
 		}
 
-		score, ok := analysisResult["Score"].(float64)
-		if !ok {
-			fmt.Println("Error: Score field not found or invalid type")
-			os.Exit(1)
+		cli.PrintSection("🔍 Análisis de " + filepath.Base(path))
+		initial := app.Engine.Analyze(p)
+		printAnalysis(initial, app.Engine.MinScoreThreshold)
+		if initial.IsReliable {
+			cli.PrintSuccess("El prompt ya alcanza el umbral: no hay nada que corregir")
+			return nil
+		}
+		if len(app.Optimizers) == 0 {
+			return errors.New("no hay proveedores disponibles: configure uno con promptc config")
 		}
-		fmt.Printf("Score: %d/100\n", int(score))
 
-		analysisResult, ok = analysis.(map[string]interface{})
-		if !ok {
-			fmt.Println("Error: invalid analysis result type")
-			os.Exit(1)
+		cli.PrintSection("🛠️  Reparación")
+		best, bestSrc, bestRes := p, src, initial
+		for i := 1; i <= fixFlags.attempts && !bestRes.IsReliable; i++ {
+			cand, candSrc, res, prov, err := fixAttempt(ctx, app, src, best)
+			if err != nil {
+				cli.PrintError(fmt.Sprintf("intento %d: %s", i, secrets.Redact(err.Error())))
+				if ctx.Err() != nil {
+					break
+				}
+				continue
+			}
+			msg := fmt.Sprintf("intento %d: %s score %d → %d", i, prov.Provider, bestRes.Score, res.Score)
+			if res.Score > bestRes.Score {
+				best, bestSrc, bestRes = cand, candSrc, res
+				cli.PrintSuccess(msg)
+			} else {
+				cli.PrintWarning(msg + " (sin mejora, se descarta)")
+			}
 		}
 
-		isReliable, ok := analysisResult["IsReliable"].(bool)
-		if !ok {
-			fmt.Println("Error: IsReliable field not found or invalid type")
-			os.Exit(1)
+		if bestRes.Score == initial.Score {
+			return fmt.Errorf("ningún intento mejoró el score %d", initial.Score)
 		}
 
-		if !isReliable {
-			optimized, err := promptcSDK.Optimize(ctx, p)
-			if err != nil {
-				fmt.Printf("\n❌ Error Crítico: %v\n", err)
-				os.Exit(1)
+		cli.PrintSection("📝 Cambios")
+		cli.PrintDiff(cli.UnifiedDiff(path, path+" (corregido)", string(src), string(bestSrc)))
+		fmt.Println()
+		printAnalysis(bestRes, app.Engine.MinScoreThreshold)
+
+		if fixFlags.write {
+			if err := writeInPlace(path, bestSrc); err != nil {
+				return err
 			}
-			cli.PrintSuccess("\n✨ Prompt Optimizado:")
-			fmt.Println("\n" + fmt.Sprint(optimized))
+			cli.PrintSuccess(path + " actualizado")
 		} else {
-			output, _ := promptcSDK.Engine.Compile(p)
-			fmt.Println("\n" + output)
+			cli.PrintInfo("Use --write para aplicar los cambios a " + path)
+		}
+
+		if !bestRes.IsReliable {
+			return fmt.Errorf("score %d bajo el umbral %d después de %d intentos", bestRes.Score, app.Engine.MinScoreThreshold, fixFlags.attempts)
 		}
+		return nil
 	},
 }
 
+// fixAttempt pide una corrección de cur, la aplica al YAML original, vuelve
+// a parsear el resultado y lo puntúa: lo que se evalúa es exactamente lo que
+// --write escribiría.
+func fixAttempt(ctx context.Context, app *sdk.PromptC, src []byte, cur core.Prompt) (core.Prompt, []byte, core.Result, core.Provenance, error) {
+	out, err := app.Repair(ctx, cur)
+	if err != nil {
+		return cur, nil, core.Result{}, core.Provenance{}, err
+	}
+	candSrc, err := parser.Update(src, out.Prompt)
+	if err != nil {
+		return cur, nil, core.Result{}, out.Provenance, err
+	}
+	cand, err := parser.Parse(candSrc)
+	if err != nil {
+		return cur, nil, core.Result{}, out.Provenance, fmt.Errorf("la corrección no es YAML válido: %w", err)
+	}
+	return cand, candSrc, app.Engine.Analyze(cand), out.Provenance, nil
+}
+
+func printAnalysis(r core.Result, threshold int) {
+	color := cli.ColorRed
+	if r.IsReliable {
+		color = cli.ColorGreen
+	}
+	fmt.Printf("Score: %s%d/100%s (umbral %d)\n", color, r.Score, cli.ColorReset, threshold)
+	for _, issue := range r.Issues {
+		fmt.Printf("  %s✖%s %s\n", cli.ColorRed, cli.ColorReset, issue)
+	}
+	for _, s := range r.Suggestions {
+		fmt.Printf("  %s→%s %s\n", cli.ColorCyan, cli.ColorReset, s)
+	}
+}
+
+// writeInPlace reemplaza el archivo con un rename atómico, conservando sus
+// permisos: un corte a mitad no deja el prompt truncado.
+func writeInPlace(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
 func init() {
+	f := fixCmd.Flags()
+	f.IntVarP(&fixFlags.attempts, "attempts", "n", 3, "intentos de corrección como máximo")
+	f.IntVar(&fixFlags.minScore, "min-score", 0, "umbral a alcanzar (default analyzer.min_score)")
+	f.BoolVarP(&fixFlags.write, "write", "w", false, "escribe la corrección en el archivo")
+	f.BoolVarP(&fixFlags.verbose, "verbose", "v", false, "muestra el log del SDK (proveedores, reintentos)")
 	rootCmd.AddCommand(fixCmd)
 }
@@ -1,67 +1,48 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/andesdevroot/promptc/pkg/core"
+	"github.com/andesdevroot/promptc/internal/secrets"
+	"github.com/andesdevroot/promptc/pkg/billing"
+	"github.com/andesdevroot/promptc/pkg/cache"
+	"github.com/andesdevroot/promptc/pkg/engine"
+	"github.com/andesdevroot/promptc/pkg/mcp"
+	"github.com/andesdevroot/promptc/pkg/provider"
+	"github.com/andesdevroot/promptc/pkg/resilience"
 	"github.com/andesdevroot/promptc/pkg/sdk"
 	"github.com/gorilla/websocket"
+	"github.com/spf13/cobra"
 )
 
-// --- INFRAESTRUCTURA ---
-const configPath = "/Users/cesarrivas/Desktop/GO/promptc/templates.json"
-const metricsPath = "/Users/cesarrivas/Desktop/GO/promptc/metrics.json"
-const auditPath = "/Users/cesarrivas/Desktop/GO/promptc/audit.log"
-
-// --- TIPOS JSON-RPC ---
-type JSONRPCMessage struct {
-	JSONRPC string          `json:"jsonrpc"`
-	ID      interface{}     `json:"id,omitempty"`
-	Method  string          `json:"method,omitempty"`
-	Params  json.RawMessage `json:"params,omitempty"`
-}
-
-type JSONRPCResponse struct {
-	JSONRPC string      `json:"jsonrpc"`
-	ID      interface{} `json:"id"`
-	Result  interface{} `json:"result,omitempty"`
-	Error   interface{} `json:"error,omitempty"`
-}
-
-type Template struct {
-	Description string `json:"description"`
-	Content     string `json:"content"`
-}
+// Template y AuditEvent son los del servidor MCP: el dashboard, el audit
+// log y el servidor comparten los mismos valores.
+type Template = mcp.Template
 
 // --- SISTEMA DE AUDITORÍA ---
-// AuditEvent representa un evento estructurado de auditoría.
-// Cada evento tiene tipo semántico, actor, recurso y resultado.
-type AuditEvent struct {
-	Timestamp string `json:"ts"`
-	Type      string `json:"type"` // KERNEL | MCP | TEMPLATE | INFERENCE | POLICY | SYSTEM
-	Action    string `json:"action"`
-	Actor     string `json:"actor"` // claude-desktop | promptc-engine | mac-mini | gemini
-	Resource  string `json:"resource,omitempty"`
-	Result    string `json:"result"` // OK | FAIL | WARN
-	LatencyMs int64  `json:"latency_ms,omitempty"`
-	Detail    string `json:"detail,omitempty"`
-}
+type AuditEvent = mcp.AuditEvent
 
 // auditLog escribe el evento al archivo de auditoría Y al stream del dashboard.
 // El archivo es append-only — nunca se trunca, es el registro regulatorio.
 func auditLog(evt AuditEvent) {
 	evt.Timestamp = time.Now().Format("2006-01-02T15:04:05.000")
+	// Un error de proveedor puede citar la key: nunca llega a ningún destino
+	evt.Resource = secrets.Redact(evt.Resource)
+	evt.Detail = secrets.Redact(evt.Detail)
 
 	// Formato legible para el dashboard stream
 	line := fmt.Sprintf("[%s] %-10s %-18s actor=%-16s",
@@ -88,12 +69,17 @@ func auditLog(evt AuditEvent) {
 		_ = c.WriteMessage(websocket.TextMessage, []byte(line))
 	}
 	hub.Unlock()
+	if mcpServer != nil {
+		mcpServer.RecordAudit(evt)
+	}
 
 	// 2. A stderr (visible en mcp.log de Claude Desktop)
-	fmt.Fprintf(os.Stderr, "%s\n", line)
+	if settings.Audit.Stderr {
+		fmt.Fprintf(os.Stderr, "%s\n", line)
+	}
 
 	// 3. Al archivo de auditoría append-only (registro regulatorio)
-	f, err := os.OpenFile(auditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	f, err := os.OpenFile(paths.AuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
 	if err == nil {
 		jsonLine, _ := json.Marshal(evt)
 		fmt.Fprintf(f, "%s\n", string(jsonLine))
@@ -104,6 +90,7 @@ func auditLog(evt AuditEvent) {
 // addLog mantiene compatibilidad con logs de sistema genéricos
 // que no son eventos de auditoría (WS connect, hot-reload, etc.)
 func addLog(msg string) {
+	msg = secrets.Redact(msg)
 	entry := fmt.Sprintf("[%s] SYSTEM     %-18s actor=promptc-engine    result=INFO | %s",
 		time.Now().Format("15:04:05.000"),
 		"INTERNAL",
@@ -118,10 +105,18 @@ func addLog(msg string) {
 	fmt.Fprintf(os.Stderr, "%s\n", entry)
 }
 
-func sendResponse(id interface{}, result interface{}) {
-	resp := JSONRPCResponse{JSONRPC: "2.0", ID: id, Result: result}
-	out, _ := json.Marshal(resp)
-	fmt.Fprintf(os.Stdout, "%s\n", string(out))
+// StreamEvent viaja por el WebSocket del dashboard mientras una inferencia
+// está en curso. Va como JSON para distinguirlo de las líneas de auditoría,
+// y no se guarda en hub.Logs: los tokens no se reproducen al reconectar.
+type StreamEvent = mcp.StreamEvent
+
+func broadcastStream(evt StreamEvent) {
+	msg, _ := json.Marshal(evt)
+	hub.Lock()
+	for c := range hub.Clients {
+		_ = c.WriteMessage(websocket.TextMessage, msg)
+	}
+	hub.Unlock()
 }
 
 // --- MÉTRICAS ---
@@ -153,8 +148,12 @@ var metrics = &Metrics{
 	TemplateCalls: make(map[string]int64),
 }
 
+// spendLedger es el gasto en USD por modelo, template y cliente. Se persiste
+// junto con las métricas en spend.json.
+var spendLedger *billing.Ledger
+
 func loadMetrics() {
-	data, err := os.ReadFile(metricsPath)
+	data, err := os.ReadFile(paths.Metrics)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "[METRICS] No hay estado previo, arrancando limpio\n")
 		return
@@ -201,15 +200,20 @@ func saveMetrics() {
 		fmt.Fprintf(os.Stderr, "[METRICS] Error serializando métricas: %v\n", err)
 		return
 	}
-	tmpPath := metricsPath + ".tmp"
+	tmpPath := paths.Metrics + ".tmp"
 	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
 		fmt.Fprintf(os.Stderr, "[METRICS] Error escribiendo métricas: %v\n", err)
 		return
 	}
-	if err := os.Rename(tmpPath, metricsPath); err != nil {
+	if err := os.Rename(tmpPath, paths.Metrics); err != nil {
 		fmt.Fprintf(os.Stderr, "[METRICS] Error en rename atómico: %v\n", err)
 		return
 	}
+	if spendLedger != nil {
+		if err := spendLedger.Save(paths.Spend); err != nil {
+			fmt.Fprintf(os.Stderr, "[METRICS] Error persistiendo gasto: %v\n", err)
+		}
+	}
 	fmt.Fprintf(os.Stderr, "[METRICS] Estado persistido en disco\n")
 }
 
@@ -305,6 +309,22 @@ func metricsSnapshotAPI() map[string]interface{} {
 	}
 }
 
+// fullMetricsSnapshot agrega a las métricas del kernel las del SDK (caché,
+// gasto y pool). Lo comparten /api/metrics y el recurso promptc://metrics.
+func fullMetricsSnapshot(app *sdk.PromptC) map[string]interface{} {
+	snap := metricsSnapshotAPI()
+	if app != nil && app.Cache != nil {
+		snap["cache"] = app.Cache.Stats()
+	}
+	if app != nil && app.Billing != nil {
+		snap["billing"] = app.Billing.Snapshot()
+	}
+	if app != nil && app.Pool != nil {
+		snap["pool"] = app.Pool.Stats()
+	}
+	return snap
+}
+
 // --- HUB DASHBOARD ---
 var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
 
@@ -320,12 +340,71 @@ var hub = &DashboardHub{
 	Templates: make(map[string]Template),
 }
 
+// hubTemplates expone los templates del hub al servidor MCP.
+type hubTemplates struct{}
+
+func (hubTemplates) Template(name string) (Template, bool) {
+	hub.Lock()
+	defer hub.Unlock()
+	tmpl, ok := hub.Templates[name]
+	return tmpl, ok
+}
+
+func (hubTemplates) Templates() map[string]Template {
+	hub.Lock()
+	defer hub.Unlock()
+	out := make(map[string]Template, len(hub.Templates))
+	for name, tmpl := range hub.Templates {
+		out[name] = tmpl
+	}
+	return out
+}
+
+// kernelMetrics conecta las métricas del kernel con el servidor MCP.
+type kernelMetrics struct {
+	app *sdk.PromptC
+}
+
+func (kernelMetrics) RecordInference(success bool, latencyMs, tokens int64, usedCloud bool) {
+	recordInference(success, latencyMs, tokens, usedCloud)
+}
+
+func (kernelMetrics) RecordTemplateCall(name string) {
+	recordTemplatCall(name)
+}
+
+func (kernelMetrics) NodeOnline() bool {
+	metrics.Lock()
+	defer metrics.Unlock()
+	return metrics.NodeOnline
+}
+
+func (m kernelMetrics) Snapshot() interface{} {
+	return fullMetricsSnapshot(m.app)
+}
+
+// mcpServer atiende Claude Desktop por stdio y a los clientes del equipo
+// por /mcp.
+var mcpServer *mcp.Server
+
+// notifyMetricsChanged avisa a los suscriptores de promptc://metrics. El
+// heartbeat arranca antes que el servidor MCP: sin él no hay a quién avisar.
+func notifyMetricsChanged() {
+	if mcpServer != nil {
+		mcpServer.MetricsChanged()
+	}
+}
+
 // --- HEARTBEAT ---
-func startHeartbeat(remoteIP string) {
+func startHeartbeat(node, apiKey string) {
 	go func() {
 		client := &http.Client{Timeout: 3 * time.Second}
 		for {
-			resp, err := client.Get(fmt.Sprintf("http://%s:11434/api/tags", remoteIP))
+			req, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/api/tags", node), nil)
+			if apiKey != "" {
+				req.Header.Set("Authorization", "Bearer "+apiKey)
+			}
+			resp, err := client.Do(req)
 			metrics.Lock()
 			if err == nil && resp.StatusCode == 200 {
 				wasOffline := !metrics.NodeOnline
@@ -334,11 +413,12 @@ func startHeartbeat(remoteIP string) {
 				resp.Body.Close()
 				metrics.Unlock()
 				if wasOffline {
+					notifyMetricsChanged()
 					auditLog(AuditEvent{
 						Type:     "KERNEL",
 						Action:   "NODE_ONLINE",
 						Actor:    "mac-mini",
-						Resource: remoteIP + ":11434",
+						Resource: node,
 						Result:   "OK",
 						Detail:   "Nodo Ollama respondió heartbeat — inferencia local disponible",
 					})
@@ -348,11 +428,12 @@ func startHeartbeat(remoteIP string) {
 				metrics.NodeOnline = false
 				metrics.Unlock()
 				if wasOnline {
+					notifyMetricsChanged()
 					auditLog(AuditEvent{
 						Type:     "KERNEL",
 						Action:   "NODE_OFFLINE",
 						Actor:    "mac-mini",
-						Resource: remoteIP + ":11434",
+						Resource: node,
 						Result:   "WARN",
 						Detail:   "Nodo no responde — activando fallback Gemini",
 					})
@@ -363,6 +444,83 @@ func startHeartbeat(remoteIP string) {
 	}()
 }
 
+// auditBreakerChange registra como evento KERNEL cada transición del
+// circuit breaker de un proveedor.
+func auditBreakerChange(provider string, from, to resilience.State, detail string) {
+	result := "OK"
+	if to != resilience.StateClosed {
+		result = "WARN"
+	}
+	auditLog(AuditEvent{
+		Type:     "KERNEL",
+		Action:   "BREAKER_" + to.String(),
+		Actor:    "promptc-engine",
+		Resource: provider,
+		Result:   result,
+		Detail:   fmt.Sprintf("%s -> %s: %s", from, to, detail),
+	})
+}
+
+// auditRaceSettled registra qué proveedor ganó una carrera hedged/race y
+// cuánto alcanzaron a gastar los perdedores antes de ser cancelados.
+func auditRaceSettled(r sdk.RaceReport) {
+	result := "OK"
+	winner := r.Winner
+	if winner == "" {
+		result = "FAIL"
+		winner = "none"
+	}
+	var losers []string
+	var wasted float64
+	for _, a := range r.Attempts {
+		if a.Provider == r.Winner {
+			continue
+		}
+		state := "failed"
+		if a.Cancelled {
+			state = "cancelled"
+		}
+		wasted += a.Cost
+		losers = append(losers, fmt.Sprintf("%s(%s %dms tokens~%d cost_usd=%.6f)", a.Provider, state, a.LatencyMs, a.Tokens, a.Cost))
+	}
+	auditLog(AuditEvent{
+		Type:     "INFERENCE",
+		Action:   "RACE_SETTLED",
+		Actor:    "promptc-engine",
+		Resource: winner,
+		Result:   result,
+		Detail:   fmt.Sprintf("mode=%s losers=[%s] wasted_usd=%.6f", r.Mode, strings.Join(losers, ", "), wasted),
+	})
+}
+
+// auditRejected registra una salida de optimizador descartada por la
+// validación posterior, con las razones del rechazo.
+func auditRejected(provider string, v engine.Verdict) {
+	auditLog(AuditEvent{
+		Type:     "POLICY",
+		Action:   "OUTPUT_REJECTED",
+		Actor:    "promptc-engine",
+		Resource: provider,
+		Result:   "WARN",
+		Detail:   fmt.Sprintf("score %d->%d | %s", v.OriginalScore, v.Score, strings.Join(v.Reasons, "; ")),
+	})
+}
+
+func auditBudgetExceeded(c sdk.Caller, d billing.Decision) {
+	result := "WARN"
+	if d.Action == billing.Refuse {
+		result = "FAIL"
+	}
+	auditLog(AuditEvent{
+		Type:     "POLICY",
+		Action:   "BUDGET_EXCEEDED",
+		Actor:    "promptc-engine",
+		Resource: d.Budget.Name,
+		Result:   result,
+		Detail:   fmt.Sprintf("%s client=%s", d, c.Client),
+	})
+}
+
 // --- DASHBOARD HTML ---
 const dashboardHTML = `<!DOCTYPE html>
 <html lang="es">
@@ -393,7 +551,7 @@ const dashboardHTML = `<!DOCTYPE html>
         @keyframes blinker { 50% { opacity: 0; } }
         .metrics-row {
             display: grid;
-            grid-template-columns: repeat(7, 1fr);
+            grid-template-columns: repeat(10, 1fr);
             gap: 8px;
             padding: 10px;
             flex-shrink: 0;
@@ -481,6 +639,33 @@ const dashboardHTML = `<!DOCTYPE html>
         .entry.SYSTEM    { color: #556655; }
         .entry.hidden    { display: none; }
 
+        .stream-panel {
+            border: 1px solid #ff9900;
+            background: #050505;
+            padding: 12px;
+            flex-shrink: 0;
+            max-height: 180px;
+            display: flex;
+            flex-direction: column;
+            box-shadow: inset 0 0 12px #ff990022;
+        }
+        .stream-panel h3 {
+            font-size: 0.65em;
+            letter-spacing: 2px;
+            color: #ff9900;
+            margin-bottom: 8px;
+            border-bottom: 1px solid #331f00;
+            padding-bottom: 6px;
+        }
+        .stream-output {
+            font-size: 0.72em;
+            color: #ffcc88;
+            white-space: pre-wrap;
+            overflow-y: auto;
+            line-height: 1.5;
+            flex-grow: 1;
+        }
+
         .ranking-panel {
             border: 1px solid #00ff41;
             background: #050505;
@@ -601,6 +786,21 @@ const dashboardHTML = `<!DOCTYPE html>
             <span class="metric-value" id="m-gemini">0</span>
             <span class="metric-sub">calls hoy</span>
         </div>
+        <div class="metric-card">
+            <span class="metric-label">Worker Pool</span>
+            <span class="metric-value" id="m-pool">--</span>
+            <span class="metric-sub" id="m-pool-sub">cola:0 / espera:0 ms</span>
+        </div>
+        <div class="metric-card">
+            <span class="metric-label">Spend (USD)</span>
+            <span class="metric-value" id="m-spend">$0.00</span>
+            <span class="metric-sub" id="m-spend-sub">mes: $0.00</span>
+        </div>
+        <div class="metric-card">
+            <span class="metric-label">Response Cache</span>
+            <span class="metric-value" id="m-cache">--</span>
+            <span class="metric-sub" id="m-cache-sub">hits:0 / miss:0</span>
+        </div>
         <div class="metric-card">
             <span class="metric-label">Templates Loaded</span>
             <span class="metric-value" id="m-templates">0</span>
@@ -624,6 +824,10 @@ const dashboardHTML = `<!DOCTYPE html>
                 </div>
                 <div class="log-entries" id="logs"></div>
             </div>
+            <div class="stream-panel">
+                <h3>// LIVE_INFERENCE_STREAM <span id="stream-status">IDLE</span></h3>
+                <div class="stream-output" id="stream"></div>
+            </div>
             <div class="ranking-panel" id="ranking-panel">
                 <h3>// TEMPLATE_POPULARITY</h3>
                 <div id="ranking"></div>
@@ -671,7 +875,26 @@ const dashboardHTML = `<!DOCTYPE html>
         // WebSocket logs
         const logsEl = document.getElementById('logs');
         const ws = new WebSocket('ws://' + location.host + '/ws');
+        const streamEl = document.getElementById('stream');
+        const streamStatus = document.getElementById('stream-status');
+        function handleStream(evt) {
+            if (evt.kind === 'start') {
+                streamEl.textContent = '';
+                streamStatus.textContent = 'RUNNING req=' + evt.id + ' via ' + evt.resource;
+            } else if (evt.kind === 'token') {
+                streamEl.textContent += evt.chunk;
+                streamEl.scrollTop = streamEl.scrollHeight;
+            } else if (evt.kind === 'end') {
+                streamStatus.textContent = 'DONE req=' + evt.id + ' result=' + evt.result;
+            }
+        }
+
         ws.onmessage = (e) => {
+            // Los eventos de streaming llegan como JSON; las líneas de auditoría como texto
+            if (e.data.charAt(0) === '{') {
+                handleStream(JSON.parse(e.data));
+                return;
+            }
             const div = document.createElement('div');
             const type = detectType(e.data);
             div.className = 'entry ' + type;
@@ -729,6 +952,30 @@ const dashboardHTML = `<!DOCTYPE html>
                     else ratioEl.className = 'metric-value offline';
                     document.getElementById('m-succfail').textContent = 'ok:' + d.success_count + ' / err:' + d.fail_count;
 
+                    if (d.pool) {
+                        const poolEl = document.getElementById('m-pool');
+                        poolEl.textContent = d.pool.active + '/' + d.pool.workers;
+                        poolEl.className = d.pool.queued >= d.pool.max_queue ? 'metric-value offline' : (d.pool.queued > 0 ? 'metric-value warn' : 'metric-value online');
+                        document.getElementById('m-pool-sub').textContent = 'cola:' + d.pool.queued + '/' + d.pool.max_queue +
+                            ' espera:' + d.pool.avg_wait_ms.toFixed(0) + 'ms busy:' + d.pool.rejected;
+                    }
+
+                    if (d.billing) {
+                        document.getElementById('m-spend').textContent = '$' + d.billing.today.toFixed(4);
+                        const over = (d.billing.budgets || []).filter(b =>
+                            (b.daily && b.spent_daily >= b.daily) || (b.monthly && b.spent_monthly >= b.monthly));
+                        document.getElementById('m-spend-sub').textContent = 'mes: $' + d.billing.month.toFixed(2) +
+                            (over.length ? ' | ' + over.length + ' budget(s) agotado(s)' : '');
+                        document.getElementById('m-spend').className = over.length ? 'metric-value warn' : 'metric-value';
+                    }
+
+                    if (d.cache) {
+                        document.getElementById('m-cache').textContent = d.cache.hit_ratio.toFixed(1) + '%';
+                        document.getElementById('m-cache-sub').textContent = 'hits:' + d.cache.hits + ' / miss:' + d.cache.misses + ' (' + d.cache.backend + ')';
+                    } else {
+                        document.getElementById('m-cache').textContent = 'OFF';
+                    }
+
                     const geminiEl = document.getElementById('m-gemini');
                     geminiEl.textContent = d.gemini_calls;
                     if (d.gemini_calls > 1400) geminiEl.className = 'metric-value offline';
@@ -760,7 +1007,7 @@ const dashboardHTML = `<!DOCTYPE html>
 </html>`
 
 // --- DASHBOARD SERVER ---
-func startDashboard() {
+func startDashboard(app *sdk.PromptC) {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -796,7 +1043,7 @@ func startDashboard() {
 
 	mux.HandleFunc("/api/metrics", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(metricsSnapshotAPI())
+		json.NewEncoder(w).Encode(fullMetricsSnapshot(app))
 	})
 
 	mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
@@ -806,6 +1053,10 @@ func startDashboard() {
 		lastHeartbeat := metrics.LastHeartbeat.Format(time.RFC3339)
 		tmplCount := len(hub.Templates)
 		metrics.Unlock()
+		var providers []resilience.BreakerSnapshot
+		if app != nil {
+			providers = app.ProviderHealth()
+		}
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":          "ok",
 			"version":         "0.3.0",
@@ -814,9 +1065,14 @@ func startDashboard() {
 			"templates_count": tmplCount,
 			"inference_count": atomic.LoadInt64(&metrics.InferenceCount),
 			"uptime_since":    startTime.Format(time.RFC3339),
+			"providers":       providers,
+			"mcp_sessions":    mcpServer.SessionCount(),
 		})
 	})
 
+	// Transporte MCP Streamable HTTP para clientes remotos del equipo
+	mux.Handle("/mcp", mcpServer.Handler())
+
 	mux.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "GET" {
 			hub.Lock()
@@ -826,10 +1082,15 @@ func startDashboard() {
 			var n map[string]Template
 			if err := json.NewDecoder(r.Body).Decode(&n); err == nil {
 				hub.Lock()
+				previous := hub.Templates
 				hub.Templates = n
 				hub.Unlock()
+				if app != nil && app.Cache != nil {
+					invalidateChangedTemplates(app.Cache, previous, n)
+				}
+				mcpServer.TemplatesChanged(previous, n)
 				data, _ := json.MarshalIndent(n, "", "  ")
-				_ = os.WriteFile(configPath, data, 0644)
+				_ = os.WriteFile(paths.Templates, data, 0644)
 				auditLog(AuditEvent{
 					Type:   "SYSTEM",
 					Action: "HOT_RELOAD",
@@ -841,257 +1102,172 @@ func startDashboard() {
 		}
 	})
 
-	if err := http.ListenAndServe(":8080", mux); err != nil {
-		addLog(fmt.Sprintf("Port 8080 busy: %v — MCP-ONLY Mode", err))
+	if err := http.ListenAndServe(settings.Dashboard.Addr, mux); err != nil {
+		addLog(fmt.Sprintf("%s ocupado: %v — MCP-ONLY Mode", settings.Dashboard.Addr, err))
 	}
 }
 
 // startTime para el health endpoint
 var startTime = time.Now()
 
-// --- TOOL HANDLERS ---
-func handleToolCall(req JSONRPCMessage, app *sdk.PromptC) {
-	var call struct {
-		Name      string          `json:"name"`
-		Arguments json.RawMessage `json:"arguments"`
-	}
-	if err := json.Unmarshal(req.Params, &call); err != nil {
-		auditLog(AuditEvent{
-			Type:   "MCP",
-			Action: "TOOL_PARSE_ERROR",
-			Actor:  "claude-desktop",
-			Result: "FAIL",
-			Detail: err.Error(),
-		})
-		sendResponse(req.ID, map[string]interface{}{
-			"content": []map[string]interface{}{
-				{"type": "text", "text": fmt.Sprintf("Error parseando tool call: %v", err)},
-			},
-		})
-		return
+// openCache construye la caché de respuestas según la sección cache
+// (memory | disk | off).
+func openCache() (*cache.Cache, error) {
+	ttl := time.Duration(settings.Cache.TTL)
+	switch mode := settings.Cache.Mode; mode {
+	case "memory":
+		return cache.New(cache.NewMemory(512), "memory", ttl), nil
+	case "disk":
+		store, err := cache.OpenBolt(paths.Cache)
+		if err != nil {
+			return nil, err
+		}
+		return cache.New(store, "bbolt", ttl), nil
+	case "off":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("cache.mode desconocido %q (memory|disk|off)", mode)
 	}
+}
 
-	// Evento MCP: Claude Desktop invocó una herramienta
-	auditLog(AuditEvent{
-		Type:     "MCP",
-		Action:   "TOOL_INVOKED",
-		Actor:    "claude-desktop",
-		Resource: call.Name,
-		Result:   "OK",
-		Detail:   "Solicitud recibida vía MCP stdio",
-	})
-
-	switch call.Name {
-	case "get_template":
-		var args struct {
-			Name string `json:"template_name"`
+// invalidateChangedTemplates borra de la caché las optimizaciones de los
+// templates modificados o eliminados en un hot reload.
+func invalidateChangedTemplates(c *cache.Cache, before, after map[string]Template) {
+	for name, old := range before {
+		if cur, ok := after[name]; ok && cur == old {
+			continue
 		}
-		if err := json.Unmarshal(call.Arguments, &args); err != nil {
+		if n := c.InvalidateTemplate(name); n > 0 {
 			auditLog(AuditEvent{
 				Type:     "TEMPLATE",
-				Action:   "GET_ARGS_INVALID",
-				Actor:    "promptc-engine",
-				Resource: "get_template",
-				Result:   "FAIL",
-				Detail:   err.Error(),
-			})
-			sendResponse(req.ID, map[string]interface{}{
-				"content": []map[string]interface{}{
-					{"type": "text", "text": fmt.Sprintf("Error: argumentos inválidos: %v", err)},
-				},
+				Action:   "CACHE_INVALIDATE",
+				Actor:    "dashboard-operator",
+				Resource: name,
+				Result:   "OK",
+				Detail:   fmt.Sprintf("%d optimizaciones descartadas por cambio de template", n),
 			})
-			return
 		}
+	}
+}
 
-		hub.Lock()
-		tmpl, ok := hub.Templates[args.Name]
-		hub.Unlock()
-
-		if !ok {
-			auditLog(AuditEvent{
-				Type:     "TEMPLATE",
-				Action:   "GET_NOT_FOUND",
-				Actor:    "promptc-engine",
-				Resource: args.Name,
-				Result:   "FAIL",
-				Detail:   "Template no registrado en templates.json",
-			})
-			sendResponse(req.ID, map[string]interface{}{
-				"content": []map[string]interface{}{
-					{"type": "text", "text": fmt.Sprintf("Error: template '%s' no encontrado", args.Name)},
-				},
-			})
-			return
-		}
-
-		recordTemplatCall(args.Name)
-		auditLog(AuditEvent{
-			Type:     "TEMPLATE",
-			Action:   "GET_SERVED",
-			Actor:    "promptc-engine",
-			Resource: args.Name,
-			Result:   "OK",
-			Detail:   fmt.Sprintf("desc=%q content_len=%d", tmpl.Description, len(tmpl.Content)),
-		})
-		sendResponse(req.ID, map[string]interface{}{
-			"content": []map[string]interface{}{
-				{"type": "text", "text": tmpl.Content},
-			},
-		})
-
-	case "optimize_prompt":
-		var args struct {
-			Role        string            `json:"role"`
-			Context     string            `json:"context"`
-			Task        string            `json:"task"`
-			Template    string            `json:"template_name"`
-			Constraints []string          `json:"constraints"`
-			Variables   map[string]string `json:"variables"`
-		}
-		if err := json.Unmarshal(call.Arguments, &args); err != nil {
-			auditLog(AuditEvent{
-				Type:     "INFERENCE",
-				Action:   "OPTIMIZE_ARGS_INVALID",
-				Actor:    "promptc-engine",
-				Resource: "optimize_prompt",
-				Result:   "FAIL",
-				Detail:   err.Error(),
-			})
-			recordInference(false, 0, 0, false)
-			sendResponse(req.ID, map[string]interface{}{
-				"content": []map[string]interface{}{
-					{"type": "text", "text": fmt.Sprintf("Error: argumentos inválidos: %v", err)},
-				},
-			})
-			return
-		}
+// openLedger arma el control de gasto con la sección billing de
+// config.yaml y restaura lo gastado en sesiones anteriores.
+func openLedger() (*billing.Ledger, error) {
+	l := billing.NewLedger(settings.Billing)
+	if err := l.Load(paths.Spend); err != nil {
+		fmt.Fprintf(os.Stderr, "[METRICS] spend.json corrupto, gasto desde cero: %v\n", err)
+	}
+	return l, nil
+}
 
-		// Inyección de template como base del Task
-		task := args.Task
-		if args.Template != "" {
-			hub.Lock()
-			tmpl, ok := hub.Templates[args.Template]
-			hub.Unlock()
-			if ok {
-				task = tmpl.Content
-				recordTemplatCall(args.Template)
-				auditLog(AuditEvent{
-					Type:     "TEMPLATE",
-					Action:   "INJECT_AS_TASK",
-					Actor:    "promptc-engine",
-					Resource: args.Template,
-					Result:   "OK",
-					Detail:   fmt.Sprintf("Template inyectado como base — variables a resolver: %d", len(args.Variables)),
-				})
-			} else {
-				auditLog(AuditEvent{
-					Type:     "TEMPLATE",
-					Action:   "INJECT_NOT_FOUND",
-					Actor:    "promptc-engine",
-					Resource: args.Template,
-					Result:   "WARN",
-					Detail:   "Template no encontrado — usando Task directo del argumento",
-				})
-			}
-		}
+// sdkConfig arma la cadena de proveedores de la configuración efectiva,
+// con las keys ya resueltas.
+func sdkConfig() sdk.Config {
+	return sdk.Config{
+		Ollama:     ollamaConfig(),
+		Gemini:     geminiConfig(),
+		OpenRouter: openrouterConfig(),
+		Providers:  settings.Routing.Providers,
+	}
+}
 
-		// Enrutamiento al nodo de inferencia
-		metrics.Lock()
-		nodeOnline := metrics.NodeOnline
-		metrics.Unlock()
-		inferenceActor := "mac-mini"
-		if !nodeOnline {
-			inferenceActor = "gemini-cloud"
+// tuneSDK aplica al SDK el ruteo, el umbral del analizador y los overrides
+// de instrucción de la configuración efectiva.
+func tuneSDK(app *sdk.PromptC) {
+	// Validados en loadSettings
+	app.Routing, _ = sdk.ParseRoutingMode(settings.Routing.Mode)
+	if d := time.Duration(settings.Routing.HedgeDelay); d > 0 {
+		app.HedgeDelay = d
+	}
+	app.Engine.MinScoreThreshold = settings.Analyzer.MinScore
+	app.Engine.ExpectedLanguage = settings.Analyzer.Language
+	if dir := settings.Routing.InstructionsDir; dir != "" {
+		if err := app.Instructions.LoadDir(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] overrides de instrucción ignorados: %v\n", err)
 		}
+	}
+}
 
-		auditLog(AuditEvent{
-			Type:     "INFERENCE",
-			Action:   "PIPELINE_START",
-			Actor:    "promptc-engine",
-			Resource: inferenceActor,
-			Result:   "OK",
-			Detail:   fmt.Sprintf("role=%q constraints=%d variables=%d", args.Role, len(args.Constraints), len(args.Variables)),
-		})
-
-		start := time.Now()
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-		defer cancel()
+// ollamaConfig ubica el nodo; la key solo hace falta si el nodo está
+// detrás de un proxy con autenticación.
+func ollamaConfig() provider.OllamaConfig {
+	key, err := providerKey("ollama")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[WARN] API key de Ollama: %v — el nodo se consulta sin autenticación\n", err)
+	}
+	return provider.OllamaConfig{
+		Host:    settings.Ollama.Host,
+		Port:    settings.Ollama.Port,
+		Model:   settings.Ollama.Model,
+		Timeout: time.Duration(settings.Ollama.Timeout),
+		APIKey:  key,
+	}
+}
 
-		res, err := app.CompileAndOptimize(ctx, core.Prompt{
-			Role:        args.Role,
-			Context:     args.Context,
-			Task:        task,
-			Constraints: args.Constraints,
-			Variables:   args.Variables,
-		})
+// geminiConfig toma la sección gemini de la configuración efectiva y le
+// agrega la API key, que no pasa por las capas (ver providerKey). No
+// consulta la API: los modelos se validan en la primera inferencia. Una
+// referencia que no resuelve deja Gemini fuera de la cadena, con un aviso.
+func geminiConfig() provider.GeminiConfig {
+	gc := settings.Gemini
+	key, err := providerKey("gemini")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[WARN] API key de Gemini: %v — continuando sin Gemini\n", err)
+	}
+	gc.APIKey = key
+	return gc
+}
 
-		latencyMs := time.Since(start).Milliseconds()
-		estimatedTokens := int64(len(res) / 4)
+// openrouterConfig es geminiConfig para OpenRouter.
+func openrouterConfig() provider.OpenRouterConfig {
+	key, err := providerKey("openrouter")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[WARN] API key de OpenRouter: %v — continuando sin OpenRouter\n", err)
+	}
+	return provider.OpenRouterConfig{
+		APIKey:  key,
+		Model:   settings.OpenRouter.Model,
+		Timeout: time.Duration(settings.OpenRouter.Timeout),
+	}
+}
 
-		if err != nil {
-			auditLog(AuditEvent{
-				Type:      "INFERENCE",
-				Action:    "PIPELINE_FAIL",
-				Actor:     inferenceActor,
-				Resource:  "optimize_prompt",
-				Result:    "FAIL",
-				LatencyMs: latencyMs,
-				Detail:    err.Error(),
-			})
-			recordInference(false, latencyMs, 0, !nodeOnline)
-			sendResponse(req.ID, map[string]interface{}{
-				"content": []map[string]interface{}{
-					{"type": "text", "text": fmt.Sprintf("Error en pipeline de optimización: %v", err)},
-				},
-			})
-			return
+// --- MAIN ---
+var rootCmd = &cobra.Command{
+	Use:   "promptc",
+	Short: "Kernel PROMPTC: servidor MCP por stdio con dashboard web",
+	Long: `Sin subcomando, promptc atiende MCP por stdio (Claude Desktop) y sirve
+el dashboard y el transporte /mcp en dashboard.addr (default :8080).`,
+	SilenceUsage: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadSettings(); err != nil {
+			return err
 		}
+		return initPaths()
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		runServer()
+	},
+}
 
-		auditLog(AuditEvent{
-			Type:      "INFERENCE",
-			Action:    "PIPELINE_OK",
-			Actor:     inferenceActor,
-			Resource:  "optimize_prompt",
-			Result:    "OK",
-			LatencyMs: latencyMs,
-			Detail: fmt.Sprintf("tokens~%d soberanía=%s", estimatedTokens, func() string {
-				if nodeOnline {
-					return "LOCAL"
-				}
-				return "CLOUD"
-			}()),
-		})
-		recordInference(true, latencyMs, estimatedTokens, !nodeOnline)
-		sendResponse(req.ID, map[string]interface{}{
-			"content": []map[string]interface{}{
-				{"type": "text", "text": res},
-			},
-		})
+func init() {
+	addConfigFlags(rootCmd)
+	addPathFlags(rootCmd)
+}
 
-	default:
-		auditLog(AuditEvent{
-			Type:     "MCP",
-			Action:   "TOOL_NOT_FOUND",
-			Actor:    "claude-desktop",
-			Resource: call.Name,
-			Result:   "FAIL",
-			Detail:   "Herramienta no registrada en el servidor MCP",
-		})
-		sendResponse(req.ID, map[string]interface{}{
-			"content": []map[string]interface{}{
-				{"type": "text", "text": fmt.Sprintf("Error: herramienta '%s' no registrada", call.Name)},
-			},
-		})
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
 	}
 }
 
-// --- MAIN ---
-func main() {
+func runServer() {
+	fmt.Fprintf(os.Stderr, "[INFO] templates=%s estado=%s\n", paths.Templates, paths.StateDir)
+
 	// 1. Restaurar métricas
 	loadMetrics()
 
 	// 2. Cargar templates
-	file, err := os.ReadFile(configPath)
+	file, err := os.ReadFile(paths.Templates)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "[WARN] No se pudo leer templates.json: %v\n", err)
 	} else {
@@ -1102,26 +1278,67 @@ func main() {
 		}
 	}
 
-	// 3. Dashboard
-	go startDashboard()
+	for _, w := range settings.Warnings() {
+		fmt.Fprintf(os.Stderr, "[WARN] %s\n", w)
+	}
 
-	// 4. Heartbeat
-	remoteIP := os.Getenv("PROMPTC_MACMINI_IP")
-	if remoteIP == "" {
-		remoteIP = "100.90.6.101"
+	// 3. Heartbeat
+	sdkCfg := sdkConfig()
+	node := net.JoinHostPort(settings.Ollama.Host, strconv.Itoa(settings.Ollama.Port))
+	if slices.Contains(settings.Routing.Providers, "ollama") {
+		startHeartbeat(node, sdkCfg.Ollama.APIKey)
 	}
-	startHeartbeat(remoteIP)
 
-	// 5. Persistencia periódica
+	// 4. Persistencia periódica
 	startMetricsPersistence()
 
-	// 6. SDK
-	app, err := sdk.NewSDK(context.Background(), os.Getenv("GEMINI_API_KEY"), remoteIP)
+	// 5. SDK
+	app, err := sdk.New(context.Background(), sdkCfg)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[SDK_ERROR] %v — continuando sin optimizadores\n", err)
+		fmt.Fprintf(os.Stderr, "[SDK_ERROR] %s — continuando sin optimizadores\n", secrets.Redact(err.Error()))
+	}
+	if app != nil {
+		app.OnBreakerChange = auditBreakerChange
+		app.OnRaceSettled = auditRaceSettled
+		app.OnRejected = auditRejected
+		tuneSDK(app)
+		if c, err := openCache(); err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] caché deshabilitada: %v\n", err)
+		} else {
+			app.Cache = c
+		}
+		app.Pool = resilience.NewPool(settings.Limits.Workers, settings.Limits.Queue)
+		if rpm := settings.Limits.ClientRPM; rpm > 0 {
+			app.ClientLimit = resilience.NewKeyedLimiter(resilience.RateLimit{Rate: float64(rpm) / 60, Burst: 5})
+		}
+		if l, err := openLedger(); err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] control de gasto deshabilitado: %v\n", err)
+		} else {
+			app.Billing = l
+			app.OnBudgetExceeded = auditBudgetExceeded
+			spendLedger = l
+		}
+	}
+
+	// 6. Servidor MCP (stdio y /mcp del dashboard)
+	mcpServer = mcp.NewServer(mcp.Config{
+		Name:            "PROMPTC",
+		Version:         "0.3.0",
+		Templates:       hubTemplates{},
+		SDK:             app,
+		Auditor:         mcp.AuditorFunc(auditLog),
+		Metrics:         kernelMetrics{app: app},
+		OnStream:        broadcastStream,
+		DefaultTeam:     settings.Routing.Team,
+		OptimizeTimeout: time.Duration(settings.Routing.OptimizeTimeout),
+	})
+
+	// 7. Dashboard
+	if settings.Dashboard.Enabled {
+		go startDashboard(app)
 	}
 
-	// 7. Graceful shutdown
+	// 8. Graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
 	go func() {
@@ -1134,128 +1351,28 @@ func main() {
 			Detail: fmt.Sprintf("Señal recibida: %v — flush de métricas iniciado", sig),
 		})
 		saveMetrics()
+		if app != nil && app.Cache != nil {
+			app.Cache.Close()
+		}
 		os.Exit(0)
 	}()
 
-	// 8. Evento de arranque del kernel
+	// 9. Evento de arranque del kernel
 	auditLog(AuditEvent{
 		Type:   "KERNEL",
 		Action: "BOOT",
 		Actor:  "promptc-engine",
 		Result: "OK",
-		Detail: fmt.Sprintf("PROMPTC v0.3.0 iniciado — nodo=%s templates=%d inferencias_previas=%d",
-			remoteIP,
+		Detail: fmt.Sprintf("PROMPTC v0.3.0 iniciado — perfil=%s nodo=%s templates=%d inferencias_previas=%d",
+			profileName(),
+			node,
 			len(hub.Templates),
 			atomic.LoadInt64(&metrics.InferenceCount),
 		),
 	})
 
-	// 9. Scanner MCP
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-
-	for scanner.Scan() {
-		var req JSONRPCMessage
-		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
-			fmt.Fprintf(os.Stderr, "[PARSE_ERROR] %v\n", err)
-			continue
-		}
-
-		switch req.Method {
-		case "initialize":
-			auditLog(AuditEvent{
-				Type:   "MCP",
-				Action: "HANDSHAKE_INIT",
-				Actor:  "claude-desktop",
-				Result: "OK",
-				Detail: "Protocolo MCP 2024-11-05 — negociación iniciada",
-			})
-			sendResponse(req.ID, map[string]interface{}{
-				"protocolVersion": "2024-11-05",
-				"serverInfo":      map[string]string{"name": "PROMPTC", "version": "0.3.0"},
-				"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
-			})
-
-		case "notifications/initialized":
-			auditLog(AuditEvent{
-				Type:   "MCP",
-				Action: "HANDSHAKE_CONFIRMED",
-				Actor:  "claude-desktop",
-				Result: "OK",
-				Detail: "Canal MCP establecido — herramientas disponibles",
-			})
-
-		case "tools/list":
-			auditLog(AuditEvent{
-				Type:   "MCP",
-				Action: "TOOLS_LIST_REQUESTED",
-				Actor:  "claude-desktop",
-				Result: "OK",
-				Detail: "Enviando schema de 2 herramientas: get_template, optimize_prompt",
-			})
-			sendResponse(req.ID, map[string]interface{}{
-				"tools": []map[string]interface{}{
-					{
-						"name":        "get_template",
-						"description": "Obtiene una plantilla industrial por nombre desde el almacén local.",
-						"inputSchema": map[string]interface{}{
-							"type":     "object",
-							"required": []string{"template_name"},
-							"properties": map[string]interface{}{
-								"template_name": map[string]string{
-									"type":        "string",
-									"description": "Nombre exacto de la plantilla registrada en templates.json",
-								},
-							},
-						},
-					},
-					{
-						"name":        "optimize_prompt",
-						"description": "Compila y optimiza un prompt usando el Mac Mini vía Tailscale con fallback a Gemini. Acepta template_name para usar una plantilla como base con resolución automática de variables.",
-						"inputSchema": map[string]interface{}{
-							"type":     "object",
-							"required": []string{"role", "context", "task"},
-							"properties": map[string]interface{}{
-								"role": map[string]string{
-									"type":        "string",
-									"description": "Rol del agente o sistema que ejecutará el prompt",
-								},
-								"context": map[string]string{
-									"type":        "string",
-									"description": "Contexto de negocio o técnico relevante para el prompt",
-								},
-								"task": map[string]string{
-									"type":        "string",
-									"description": "Tarea concreta. Ignorada si se provee template_name",
-								},
-								"template_name": map[string]string{
-									"type":        "string",
-									"description": "Nombre del template en templates.json para usar como base del Task con resolución automática de {{variables}}",
-								},
-								"constraints": map[string]interface{}{
-									"type":        "array",
-									"description": "Restricciones opcionales",
-									"items":       map[string]string{"type": "string"},
-								},
-								"variables": map[string]interface{}{
-									"type":        "object",
-									"description": "Variables de sustitución para resolver {{placeholders}} del template",
-									"additionalProperties": map[string]string{
-										"type": "string",
-									},
-								},
-							},
-						},
-					},
-				},
-			})
-
-		case "tools/call":
-			handleToolCall(req, app)
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
+	// 10. MCP sobre stdio
+	if err := mcpServer.Serve(os.Stdin, os.Stdout); err != nil {
 		fmt.Fprintf(os.Stderr, "[SCANNER_ERROR] %v\n", err)
 	}
 }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andesdevroot/promptc/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// --- RUTAS DE ALMACENAMIENTO ---
+// Cada archivo se resuelve, en orden: flag, variable de entorno, sección
+// paths de config.yaml y por último los directorios XDG:
+//
+//	templates.json secrets.vault        $XDG_CONFIG_HOME/promptc (~/.config/promptc)
+//	metrics.json audit.log cache.db
+//	spend.json                          $XDG_STATE_HOME/promptc (~/.local/state/promptc)
+
+// storagePaths son las rutas resueltas para esta ejecución.
+type storagePaths struct {
+	ConfigDir string
+	StateDir  string
+	Templates string
+	Metrics   string
+	AuditLog  string
+	Cache     string
+	Spend     string
+	Vault     string
+}
+
+var paths storagePaths
+
+// pathFlags recibe los flags persistentes de rootCmd.
+var pathFlags config.PathsConfig
+
+func addPathFlags(cmd *cobra.Command) {
+	f := cmd.PersistentFlags()
+	f.StringVar(&pathFlags.ConfigDir, "config-dir", "", "directorio de templates.json (env PROMPTC_CONFIG_DIR)")
+	f.StringVar(&pathFlags.StateDir, "state-dir", "", "directorio de métricas, auditoría, caché y gasto (env PROMPTC_STATE_DIR)")
+	f.StringVar(&pathFlags.Templates, "templates", "", "ruta de templates.json (env PROMPTC_TEMPLATES)")
+	f.StringVar(&pathFlags.Metrics, "metrics", "", "ruta de metrics.json (env PROMPTC_METRICS)")
+	f.StringVar(&pathFlags.AuditLog, "audit-log", "", "ruta del audit log append-only (env PROMPTC_AUDIT_LOG)")
+	f.StringVar(&pathFlags.Cache, "cache-db", "", "ruta de la caché en disco (env PROMPTC_CACHE_DB)")
+	f.StringVar(&pathFlags.Spend, "spend", "", "ruta de spend.json (env PROMPTC_SPEND)")
+	f.StringVar(&pathFlags.Vault, "vault", "", "ruta de la bóveda cifrada de secretos (env PROMPTC_VAULT)")
+}
+
+// resolvePaths aplica la precedencia flag > entorno > config.yaml > XDG.
+func resolvePaths(file config.PathsConfig) (storagePaths, error) {
+	pick := func(flag, env, fromFile string) (string, error) {
+		v := flag
+		if v == "" {
+			v = os.Getenv(env)
+		}
+		if v == "" {
+			v = fromFile
+		}
+		return expandHome(v)
+	}
+
+	var p storagePaths
+	var err error
+	if p.ConfigDir, err = pick(pathFlags.ConfigDir, "PROMPTC_CONFIG_DIR", file.ConfigDir); err != nil {
+		return p, err
+	}
+	if p.ConfigDir == "" {
+		if p.ConfigDir, err = xdgDir("XDG_CONFIG_HOME", ".config"); err != nil {
+			return p, err
+		}
+	}
+	if p.StateDir, err = pick(pathFlags.StateDir, "PROMPTC_STATE_DIR", file.StateDir); err != nil {
+		return p, err
+	}
+	if p.StateDir == "" {
+		if p.StateDir, err = xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state")); err != nil {
+			return p, err
+		}
+	}
+
+	files := []struct {
+		dst                 *string
+		flag, env, fromFile string
+		dir, name           string
+	}{
+		{&p.Templates, pathFlags.Templates, "PROMPTC_TEMPLATES", file.Templates, p.ConfigDir, "templates.json"},
+		{&p.Metrics, pathFlags.Metrics, "PROMPTC_METRICS", file.Metrics, p.StateDir, "metrics.json"},
+		{&p.AuditLog, pathFlags.AuditLog, "PROMPTC_AUDIT_LOG", file.AuditLog, p.StateDir, "audit.log"},
+		{&p.Cache, pathFlags.Cache, "PROMPTC_CACHE_DB", file.Cache, p.StateDir, "cache.db"},
+		{&p.Spend, pathFlags.Spend, "PROMPTC_SPEND", file.Spend, p.StateDir, "spend.json"},
+		{&p.Vault, pathFlags.Vault, "PROMPTC_VAULT", file.Vault, p.ConfigDir, "secrets.vault"},
+	}
+	for _, f := range files {
+		v, err := pick(f.flag, f.env, f.fromFile)
+		if err != nil {
+			return p, err
+		}
+		if v == "" {
+			v = filepath.Join(f.dir, f.name)
+		}
+		*f.dst = v
+	}
+	return p, nil
+}
+
+// xdgDir retorna $env/promptc, o ~/fallback/promptc si la variable no
+// está definida o no es absoluta (la especificación XDG pide ignorarla).
+func xdgDir(env, fallback string) (string, error) {
+	if base := os.Getenv(env); filepath.IsAbs(base) {
+		return filepath.Join(base, "promptc"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("no se pudo resolver el directorio home para %s: %w", env, err)
+	}
+	return filepath.Join(home, fallback, "promptc"), nil
+}
+
+// expandHome reemplaza el prefijo ~/ por el directorio home.
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+// pathsConfig retorna paths.* de la configuración efectiva. Los subcomandos
+// de config no pasan por loadSettings y deben funcionar aunque la
+// configuración no valide (es lo que vienen a corregir): se intenta
+// resolverla y, si falla, se usa el archivo base sin perfil ni --set.
+func pathsConfig() config.PathsConfig {
+	if settingsLoaded {
+		return settings.Paths
+	}
+	useConfigFile()
+	if cfg, err := config.Resolve(configOptions()); err == nil {
+		return cfg.Paths
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[WARN] config.yaml ilegible: %v — rutas por defecto\n", err)
+	}
+	return cfg.Paths
+}
+
+// ensureDirs crea los directorios de todas las rutas. Se crean 0700: el
+// estado incluye el audit log y el gasto por cliente, que no deben ser
+// legibles por otros usuarios del servidor.
+func (p storagePaths) ensureDirs() error {
+	dirs := []string{p.ConfigDir, p.StateDir}
+	for _, file := range []string{p.Templates, p.Metrics, p.AuditLog, p.Cache, p.Spend, p.Vault} {
+		dirs = append(dirs, filepath.Dir(file))
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("no se pudo crear %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// initPaths resuelve y crea las rutas antes de cualquier comando, desde la
+// configuración efectiva: paths.* de un perfil o de --set también cuentan.
+func initPaths() error {
+	p, err := resolvePaths(pathsConfig())
+	if err != nil {
+		return err
+	}
+	if err := p.ensureDirs(); err != nil {
+		return err
+	}
+	paths = p
+	return nil
+}
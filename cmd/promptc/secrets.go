@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/andesdevroot/promptc/internal/cli"
+	"github.com/andesdevroot/promptc/internal/secrets"
+	"github.com/spf13/cobra"
+)
+
+// --- SECRETOS ---
+// Las API keys se guardan como referencias (env:, file:, cmd:, keyring:,
+// vault:) y se resuelven al arrancar; los valores nunca se escriben en
+// config.yaml, el audit log ni la salida de config show.
+
+func secretResolver() secrets.Resolver {
+	return secrets.Resolver{VaultPath: paths.Vault}
+}
+
+// keyEnv son las variables de entorno que, definidas, reemplazan la key de
+// config.yaml de cada proveedor.
+var keyEnv = map[string]string{
+	"gemini":     "GEMINI_API_KEY",
+	"openrouter": "OPENROUTER_API_KEY",
+}
+
+// providerKey resuelve la key de un proveedor: su variable de entorno,
+// keys.<name>, o api_key si provider es name. Vacío sin error si no hay key
+// configurada.
+func providerKey(name string) (string, error) {
+	if key := os.Getenv(keyEnv[name]); keyEnv[name] != "" && key != "" {
+		secrets.Register(key)
+		return key, nil
+	}
+	ref := settings.Keys[name]
+	if ref == "" && settings.Provider == name {
+		ref = settings.APIKey
+	}
+	if ref == "" {
+		return "", nil
+	}
+	return secretResolver().Resolve(context.Background(), ref)
+}
+
+// storeKey guarda la key de un proveedor y retorna la referencia que va en
+// config.yaml: la bóveda si PROMPTC_VAULT_PASSPHRASE está definida, si no
+// el llavero del sistema. Nunca cae a texto plano.
+func storeKey(name, value string) (string, error) {
+	if secrets.Passphrase(nil) != "" {
+		return storeInVault(name, value)
+	}
+	ref, err := storeInKeyring(name, value)
+	if err != nil {
+		return "", fmt.Errorf("%w; defina %s para usar la bóveda cifrada, o escriba una referencia env:, file: o cmd:", err, secrets.PassphraseEnv)
+	}
+	return ref, nil
+}
+
+func storeInVault(name, value string) (string, error) {
+	v, err := secrets.OpenVault(paths.Vault, secrets.Passphrase(nil))
+	if err != nil {
+		return "", err
+	}
+	v.Set(name, value)
+	if err := v.Save(); err != nil {
+		return "", err
+	}
+	return secrets.SchemeVault + ":" + name, nil
+}
+
+func storeInKeyring(name, value string) (string, error) {
+	account := secrets.KeyringService + "/" + name
+	if err := secrets.KeyringSet(context.Background(), account, value); err != nil {
+		return "", err
+	}
+	return secrets.SchemeKeyring + ":" + account, nil
+}
+
+// readSecret lee un secreto de una línea desde stdin, sin eco en el log.
+func readSecret(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	value := strings.TrimSpace(line)
+	if value == "" {
+		return "", errors.New("secreto vacío")
+	}
+	return value, nil
+}
+
+var secretsKeyring bool
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Administra la bóveda cifrada y el llavero de API keys",
+	Long: `Las API keys de config.yaml (api_key y keys.<proveedor>) aceptan referencias:
+
+  env:GEMINI_API_KEY          variable de entorno
+  file:/run/secrets/gemini    contenido de un archivo
+  cmd:pass show gemini        salida de un comando
+  keyring:promptc/gemini      llavero del sistema (Keychain, Secret Service)
+  vault:gemini                bóveda cifrada local (PROMPTC_VAULT_PASSPHRASE)
+
+La bóveda usa AES-256-GCM con una clave derivada de PROMPTC_VAULT_PASSPHRASE
+y se guarda en --vault (default $XDG_CONFIG_HOME/promptc/secrets.vault).`,
+}
+
+var secretsSetCmd = &cobra.Command{
+	Use:   "set <nombre>",
+	Short: "Guarda un secreto leído de stdin en la bóveda (o el llavero con --keyring)",
+	Example: `  printf '%s' "$KEY" | promptc secrets set gemini
+  promptc config set keys.gemini vault:gemini`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if stdinIsTerminal() {
+			fmt.Fprintf(os.Stderr, "🔑 Valor de %s (una línea):\n", name)
+		}
+		value, err := readSecret(os.Stdin)
+		if err != nil {
+			return err
+		}
+		store := storeInVault
+		if secretsKeyring {
+			store = storeInKeyring
+		}
+		ref, err := store(name, value)
+		if err != nil {
+			return err
+		}
+		cli.PrintSuccess(fmt.Sprintf("%s guardado; referencia: %s", name, ref))
+		return nil
+	},
+}
+
+var secretsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lista los nombres guardados en la bóveda (nunca los valores)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		v, err := secrets.OpenVault(paths.Vault, secrets.Passphrase(nil))
+		if err != nil {
+			return err
+		}
+		names := v.Names()
+		if len(names) == 0 {
+			fmt.Printf("# %s está vacía\n", paths.Vault)
+			return nil
+		}
+		fmt.Printf("# %s\n", paths.Vault)
+		for _, name := range names {
+			fmt.Printf("%s:%s\n", secrets.SchemeVault, name)
+		}
+		return nil
+	},
+}
+
+var secretsRmCmd = &cobra.Command{
+	Use:   "rm <nombre>",
+	Short: "Elimina un secreto de la bóveda",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		v, err := secrets.OpenVault(paths.Vault, secrets.Passphrase(nil))
+		if err != nil {
+			return err
+		}
+		if !v.Delete(args[0]) {
+			return fmt.Errorf("%s no existe en la bóveda %s", args[0], paths.Vault)
+		}
+		if err := v.Save(); err != nil {
+			return err
+		}
+		cli.PrintSuccess(fmt.Sprintf("%s eliminado de la bóveda", args[0]))
+		return nil
+	},
+}
+
+var secretsCheckCmd = &cobra.Command{
+	Use:   "check [referencia]",
+	Short: "Resuelve una referencia, o las keys de la configuración, sin mostrar los valores",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		refs := map[string]string{}
+		if len(args) == 1 {
+			// La etiqueta no repite el argumento: podría ser una key literal
+			refs["referencia"] = args[0]
+		} else {
+			if settings.APIKey != "" {
+				refs["api_key"] = settings.APIKey
+			}
+			for name, ref := range settings.Keys {
+				refs["keys."+name] = ref
+			}
+		}
+		if len(refs) == 0 {
+			cli.PrintInfo("La configuración no tiene API keys")
+			return nil
+		}
+
+		failed := 0
+		for _, key := range sortedNames(refs) {
+			ref := refs[key]
+			value, err := secretResolver().Resolve(context.Background(), ref)
+			switch {
+			case err != nil:
+				failed++
+				cli.PrintError(fmt.Sprintf("%s: %v", key, err))
+			case secrets.Plaintext(ref):
+				cli.PrintWarning(fmt.Sprintf("%s: texto plano en config.yaml (%d caracteres)", key, len(value)))
+			default:
+				cli.PrintSuccess(fmt.Sprintf("%s: %s resuelve (%d caracteres)", key, ref, len(value)))
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d referencias sin resolver", failed)
+		}
+		return nil
+	},
+}
+
+func sortedNames(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func init() {
+	secretsSetCmd.Flags().BoolVar(&secretsKeyring, "keyring", false, "guarda en el llavero del sistema (servicio promptc) en vez de la bóveda")
+	secretsCmd.AddCommand(secretsSetCmd, secretsListCmd, secretsRmCmd, secretsCheckCmd)
+	rootCmd.AddCommand(secretsCmd)
+}
@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext son las líneas sin cambios que rodean cada bloque, como en
+// diff -u.
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-', '+'
+	line string
+}
+
+// UnifiedDiff retorna la diferencia entre a y b en formato unificado
+// (diff -u), o "" si son iguales. Usa LCS por líneas: pensado para prompts
+// de decenas de líneas, no para archivos grandes.
+func UnifiedDiff(nameA, nameB, a, b string) string {
+	if a == b {
+		return ""
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", nameA, nameB)
+	for start := 0; start < len(ops); {
+		// Siguiente cambio
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		from := max(start-diffContext, 0)
+		// El bloque se extiende mientras los cambios estén a menos de
+		// 2*diffContext líneas iguales entre sí
+		end, equal := start, 0
+		for i := start; i < len(ops) && equal <= 2*diffContext; i++ {
+			if ops[i].kind == ' ' {
+				equal++
+			} else {
+				end, equal = i, 0
+			}
+		}
+		to := min(end+diffContext+1, len(ops))
+
+		lineA, lineB := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				lineA++
+			}
+			if op.kind != '-' {
+				lineB++
+			}
+		}
+		countA, countB := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				countA++
+			}
+			if op.kind != '-' {
+				countB++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(lineA, countA), hunkRange(lineB, countB))
+		for _, op := range ops[from:to] {
+			fmt.Fprintf(&sb, "%c%s\n", op.kind, op.line)
+		}
+		start = to
+	}
+	return sb.String()
+}
+
+// PrintDiff imprime un diff unificado con las líneas agregadas en verde y
+// las eliminadas en rojo.
+func PrintDiff(diff string) {
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			fmt.Println(Bold + line + ColorReset)
+		case strings.HasPrefix(line, "@@"):
+			fmt.Println(ColorCyan + line + ColorReset)
+		case strings.HasPrefix(line, "+"):
+			fmt.Println(ColorGreen + line + ColorReset)
+		case strings.HasPrefix(line, "-"):
+			fmt.Println(ColorRed + line + ColorReset)
+		default:
+			fmt.Println(line)
+		}
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// diff -u informa la línea anterior a un bloque vacío
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines alinea a y b por su subsecuencia común más larga.
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] = largo de la LCS de a[i:] y b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
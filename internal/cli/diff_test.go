@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numbered retorna las líneas "l1".."ln" con salto final, reemplazando las
+// indicadas en edits.
+func numbered(n int, edits map[int]string) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		line := fmt.Sprintf("l%d", i)
+		if e, ok := edits[i]; ok {
+			line = e
+		}
+		if line != "" {
+			sb.WriteString(line + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// hunks extrae los encabezados @@ de un diff.
+func hunks(diff string) []string {
+	var out []string
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "@@") {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+func TestUnifiedDiffHunkHeaders(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+		want []string
+	}{
+		{"iguales", "a\nb\n", "a\nb\n", nil},
+		{"cambio al medio", numbered(10, nil), numbered(10, map[int]string{5: "x"}), []string{"@@ -2,7 +2,7 @@"}},
+		{"cambio en la primera línea", numbered(5, nil), numbered(5, map[int]string{1: "x"}), []string{"@@ -1,4 +1,4 @@"}},
+		{"línea agregada al final", "a\n", "a\nb\n", []string{"@@ -1 +1,2 @@"}},
+		{"desde vacío", "", "a\n", []string{"@@ -0,0 +1 @@"}},
+		{"hasta vacío", "a\nb\n", "", []string{"@@ -1,2 +0,0 @@"}},
+		{
+			// Más de 2*3 líneas iguales entre los cambios: dos bloques
+			"cambios lejanos",
+			numbered(20, nil),
+			numbered(20, map[int]string{2: "x", 18: "y"}),
+			[]string{"@@ -1,5 +1,5 @@", "@@ -15,6 +15,6 @@"},
+		},
+		{
+			// Hasta 2*3 líneas iguales: un solo bloque
+			"cambios cercanos",
+			numbered(20, nil),
+			numbered(20, map[int]string{5: "x", 11: "y"}),
+			[]string{"@@ -2,13 +2,13 @@"},
+		},
+		{"línea eliminada", numbered(3, nil), numbered(3, map[int]string{2: ""}), []string{"@@ -1,3 +1,2 @@"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			diff := UnifiedDiff("a.yaml", "b.yaml", tc.a, tc.b)
+			if tc.want == nil {
+				if diff != "" {
+					t.Fatalf("diff de textos iguales = %q", diff)
+				}
+				return
+			}
+			if !strings.HasPrefix(diff, "--- a.yaml\n+++ b.yaml\n") {
+				t.Errorf("encabezado = %q", diff)
+			}
+			got := hunks(diff)
+			if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+				t.Errorf("bloques = %v, se esperaba %v\n%s", got, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiffBody(t *testing.T) {
+	diff := UnifiedDiff("a", "b", "uno\ndos\ntres\n", "uno\nDOS\ntres\n")
+	want := "--- a\n+++ b\n@@ -1,3 +1,3 @@\n uno\n-dos\n+DOS\n tres\n"
+	if diff != want {
+		t.Errorf("diff =\n%s\nse esperaba\n%s", diff, want)
+	}
+}
@@ -1,66 +1,240 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/andesdevroot/promptc/pkg/billing"
+	"github.com/andesdevroot/promptc/pkg/provider"
 	"gopkg.in/yaml.v3"
 )
 
 // AppConfig representa la estructura del archivo ~/.promptc/config.yaml
 type AppConfig struct {
+	// Profile es el perfil activo si no se elige otro con --profile o PROMPTC_PROFILE
+	Profile string `yaml:"profile,omitempty"`
+
 	Provider string `yaml:"provider"`
-	APIKey   string `yaml:"api_key"`
+	// APIKey es la key de Provider: literal (obsoleto, texto plano) o una
+	// referencia env:, file:, cmd:, keyring: o vault: (ver internal/secrets)
+	APIKey string `yaml:"api_key"`
+
+	// Keys son las keys por proveedor (gemini, ollama, openrouter), con las mismas
+	// referencias que APIKey; tienen prioridad sobre ella
+	Keys map[string]string `yaml:"keys,omitempty"`
+
+	// Ollama ubica el nodo de inferencia local
+	Ollama OllamaConfig `yaml:"ollama,omitempty"`
+
+	// Gemini define modelos, seguridad y formato de respuesta del proveedor cloud
+	Gemini provider.GeminiConfig `yaml:"gemini,omitempty"`
+
+	// OpenRouter define el modelo y el plazo del proveedor OpenRouter
+	OpenRouter OpenRouterConfig `yaml:"openrouter,omitempty"`
+
+	// Routing define qué proveedores se usan, en qué orden y con qué plazos
+	Routing RoutingConfig `yaml:"routing,omitempty"`
+
+	// Limits acota la concurrencia y la tasa por cliente
+	Limits LimitsConfig `yaml:"limits,omitempty"`
+
+	// Cache define dónde y por cuánto tiempo se guardan las optimizaciones
+	Cache CacheConfig `yaml:"cache,omitempty"`
+
+	// Dashboard define el servidor HTTP del dashboard y de /mcp
+	Dashboard DashboardConfig `yaml:"dashboard,omitempty"`
+
+	// Audit define los destinos del audit log además del archivo
+	Audit AuditConfig `yaml:"audit,omitempty"`
+
+	// Analyzer define el umbral de calidad y el idioma esperado
+	Analyzer AnalyzerConfig `yaml:"analyzer,omitempty"`
+
+	// Billing define precios por modelo y presupuestos por template o cliente
+	Billing billing.Config `yaml:"billing,omitempty"`
+
+	// Paths reubica los archivos del servidor; vacío usa los directorios XDG
+	Paths PathsConfig `yaml:"paths,omitempty"`
+
+	// Profiles son capas parciales con la misma forma que este archivo; el
+	// perfil activo se aplica encima de la configuración base
+	Profiles map[string]map[string]interface{} `yaml:"profiles,omitempty"`
 }
 
-// getConfigPath resuelve la ruta absoluta al archivo de configuración del usuario
-func getConfigPath() (string, error) {
-	home, err := os.UserHomeDir()
+// OllamaConfig es la sección ollama de config.yaml.
+type OllamaConfig struct {
+	Host    string   `yaml:"host"` // IP Tailscale del nodo
+	Port    int      `yaml:"port"`
+	Model   string   `yaml:"model"`
+	Timeout Duration `yaml:"timeout"`
+}
+
+// OpenRouterConfig es la sección openrouter de config.yaml.
+type OpenRouterConfig struct {
+	Model   string   `yaml:"model"` // ej: anthropic/claude-3.5-sonnet
+	Timeout Duration `yaml:"timeout"`
+}
+
+// RoutingConfig es la sección routing de config.yaml.
+type RoutingConfig struct {
+	Mode            string   `yaml:"mode"`      // sequential | hedged | race
+	Providers       []string `yaml:"providers"` // orden de la cadena: ollama, gemini, openrouter
+	HedgeDelay      Duration `yaml:"hedge_delay"`
+	OptimizeTimeout Duration `yaml:"optimize_timeout"` // plazo de optimize_prompt, incluida la cola
+	Team            string   `yaml:"team"`             // equipo por defecto para la instrucción
+	InstructionsDir string   `yaml:"instructions_dir"` // overrides de instrucción por equipo
+}
+
+// LimitsConfig es la sección limits de config.yaml.
+type LimitsConfig struct {
+	Workers   int `yaml:"workers"`    // inferencias simultáneas
+	Queue     int `yaml:"queue"`      // solicitudes en espera antes de responder ocupado
+	ClientRPM int `yaml:"client_rpm"` // solicitudes por minuto por cliente MCP; 0 = sin límite
+}
+
+// CacheConfig es la sección cache de config.yaml.
+type CacheConfig struct {
+	Mode string   `yaml:"mode"` // memory | disk | off
+	TTL  Duration `yaml:"ttl"`
+}
+
+// DashboardConfig es la sección dashboard de config.yaml.
+type DashboardConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Addr    string `yaml:"addr"`
+}
+
+// AuditConfig es la sección audit de config.yaml. El archivo append-only
+// no se puede desactivar: es el registro regulatorio.
+type AuditConfig struct {
+	Stderr bool `yaml:"stderr"` // copia cada evento a stderr (mcp.log de Claude Desktop)
+}
+
+// AnalyzerConfig es la sección analyzer de config.yaml.
+type AnalyzerConfig struct {
+	MinScore int    `yaml:"min_score"` // score bajo el cual el prompt se optimiza
+	Language string `yaml:"language"`  // idioma que se exige a la salida: es | en
+}
+
+// PathsConfig es la sección paths de config.yaml. Los archivos sin ruta
+// propia van dentro de ConfigDir (templates y bóveda) o StateDir (el resto).
+type PathsConfig struct {
+	ConfigDir string `yaml:"config_dir,omitempty"`
+	StateDir  string `yaml:"state_dir,omitempty"`
+	Templates string `yaml:"templates,omitempty"`
+	Metrics   string `yaml:"metrics,omitempty"`
+	AuditLog  string `yaml:"audit_log,omitempty"`
+	Cache     string `yaml:"cache,omitempty"`
+	Spend     string `yaml:"spend,omitempty"`
+	Vault     string `yaml:"vault,omitempty"`
+}
+
+// Duration es un time.Duration que en YAML se escribe como texto ("30s").
+type Duration time.Duration
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(n *yaml.Node) error {
+	var s string
+	if err := n.Decode(&s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("duración inválida %q (ej: 500ms, 30s, 2m)", s)
 	}
+	*d = Duration(v)
+	return nil
+}
+
+// filePath reemplaza la ruta por defecto (--config o PROMPTC_CONFIG).
+var filePath string
+
+// SetPath cambia el archivo que leen Load, Resolve y Update.
+func SetPath(path string) {
+	filePath = path
+}
 
-	dir := filepath.Join(home, ".promptc")
-	// Creamos el directorio si no existe (0755 = rwxr-xr-x)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+// Path retorna el archivo de configuración en uso.
+func Path() (string, error) {
+	return getConfigPath()
+}
+
+// getConfigPath resuelve la ruta absoluta al archivo de configuración del
+// usuario. No crea nada: el directorio se crea recién al escribir.
+func getConfigPath() (string, error) {
+	if filePath != "" {
+		return filePath, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
 		return "", err
 	}
 
-	return filepath.Join(dir, "config.yaml"), nil
+	return filepath.Join(home, ".promptc", "config.yaml"), nil
 }
 
 // Load lee la configuración del disco. Si no existe, devuelve una estructura vacía.
+// No aplica defaults, perfiles ni variables de entorno: para eso está Resolve.
 func Load() (AppConfig, error) {
 	var cfg AppConfig
-	path, err := getConfigPath()
-	if err != nil {
+	data, err := readFile()
+	if err != nil || data == nil {
 		return cfg, err
 	}
 
-	data, err := os.ReadFile(path)
+	err = yaml.Unmarshal(data, &cfg)
+	return cfg, err
+}
+
+// readFile retorna nil sin error si el archivo no existe aún.
+func readFile() ([]byte, error) {
+	path, err := getConfigPath()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return cfg, nil // Es válido que no exista aún
-		}
-		return cfg, err
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil // Es válido que no exista aún
 	}
+	return data, err
+}
 
-	err = yaml.Unmarshal(data, &cfg)
-	return cfg, err
+// loadRaw lee el archivo como mapa genérico, sin defaults.
+func loadRaw() (map[string]interface{}, error) {
+	data, err := readFile()
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+	return raw, nil
 }
 
-// Save escribe la configuración en el disco de forma segura.
-func Save(cfg AppConfig) error {
+func writeRaw(raw map[string]interface{}) error {
 	path, err := getConfigPath()
 	if err != nil {
 		return err
 	}
 
-	data, err := yaml.Marshal(&cfg)
+	data, err := yaml.Marshal(raw)
 	if err != nil {
 		return err
 	}
 
+	// 0700 como los directorios de estado: el archivo puede traer API keys
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
 	// 0600 = rw------- (Solo el dueño puede leer/escribir. Fundamental para guardar API Keys)
 	return os.WriteFile(path, data, 0600)
 }
@@ -0,0 +1,67 @@
+package config
+
+import "time"
+
+// Defaults es la configuración sin archivo, perfil ni entorno: el nodo
+// Mac mini por Tailscale con respaldo Gemini y el dashboard en :8080.
+func Defaults() AppConfig {
+	return AppConfig{
+		Ollama: OllamaConfig{
+			Host:    "100.90.6.101",
+			Port:    11434,
+			Model:   "llama3",
+			Timeout: Duration(60 * time.Second),
+		},
+		OpenRouter: OpenRouterConfig{
+			Model:   "anthropic/claude-3.5-sonnet",
+			Timeout: Duration(60 * time.Second),
+		},
+		Routing: RoutingConfig{
+			Mode:            "sequential",
+			Providers:       []string{"ollama", "gemini"},
+			HedgeDelay:      Duration(8 * time.Second),
+			OptimizeTimeout: Duration(90 * time.Second),
+		},
+		Limits: LimitsConfig{
+			Workers:   2,
+			Queue:     8,
+			ClientRPM: 30,
+		},
+		Cache: CacheConfig{
+			Mode: "memory",
+			TTL:  Duration(24 * time.Hour),
+		},
+		Dashboard: DashboardConfig{
+			Enabled: true,
+			Addr:    ":8080",
+		},
+		Audit: AuditConfig{
+			Stderr: true,
+		},
+		Analyzer: AnalyzerConfig{
+			MinScore: 85,
+			Language: "es",
+		},
+	}
+}
+
+// builtinProfiles son los perfiles que existen sin declararlos. Un perfil
+// del mismo nombre en config.yaml se aplica encima del predefinido.
+var builtinProfiles = map[string]map[string]interface{}{
+	// dev: todo en memoria y el dashboard solo en localhost
+	"dev": {
+		"cache":     map[string]interface{}{"mode": "memory"},
+		"dashboard": map[string]interface{}{"addr": "127.0.0.1:8080"},
+	},
+	// prod: caché en disco para sobrevivir reinicios y carrera hedged para
+	// acotar la latencia de cola
+	"prod": {
+		"routing": map[string]interface{}{"mode": "hedged"},
+		"cache":   map[string]interface{}{"mode": "disk"},
+	},
+	// air-gapped: ningún dato sale de la red; solo el nodo local
+	"air-gapped": {
+		"routing":   map[string]interface{}{"mode": "sequential", "providers": []interface{}{"ollama"}},
+		"dashboard": map[string]interface{}{"addr": "127.0.0.1:8080"},
+	},
+}
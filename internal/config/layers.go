@@ -0,0 +1,476 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- CAPAS DE CONFIGURACIÓN ---
+// La configuración efectiva se arma por capas; cada una pisa solo las
+// claves que declara:
+//
+//	1. Defaults()
+//	2. config.yaml, sin la sección profiles
+//	3. perfil activo: el predefinido y luego profiles.<nombre> del archivo
+//	4. variables de entorno (envKeys)
+//	5. flags --set clave=valor
+//
+// Cada capa se valida por separado para que el error nombre su origen.
+
+// Options son las capas que no salen del archivo.
+type Options struct {
+	// Profile elige el perfil; vacío usa PROMPTC_PROFILE y luego profile del archivo
+	Profile string
+	// Overrides son los --set, en orden: "limits.workers=4"
+	Overrides []string
+	// Getenv lee el entorno; nil usa os.Getenv
+	Getenv func(string) string
+}
+
+// envKey asocia una variable de entorno a una clave de la configuración.
+type envKey struct {
+	Env   string
+	Key   string
+	parse func(string) interface{}
+}
+
+// envKeys son las variables reconocidas. Las API keys no están aquí: se
+// resuelven aparte para que no terminen en la configuración efectiva.
+var envKeys = []envKey{
+	{Env: "PROMPTC_PROVIDER", Key: "provider"},
+	{Env: "PROMPTC_MACMINI_IP", Key: "ollama.host"},
+	{Env: "PROMPTC_OLLAMA_HOST", Key: "ollama.host"},
+	{Env: "PROMPTC_OLLAMA_PORT", Key: "ollama.port"},
+	{Env: "PROMPTC_OLLAMA_MODEL", Key: "ollama.model"},
+	{Env: "PROMPTC_OLLAMA_TIMEOUT", Key: "ollama.timeout"},
+	{Env: "GEMINI_MODEL", Key: "gemini.models", parse: parseList},
+	{Env: "GEMINI_DISCOVER_MODELS", Key: "gemini.discover", parse: parseFlag},
+	{Env: "PROMPTC_OPENROUTER_MODEL", Key: "openrouter.model"},
+	{Env: "PROMPTC_OPENROUTER_TIMEOUT", Key: "openrouter.timeout"},
+	{Env: "PROMPTC_ROUTING", Key: "routing.mode"},
+	{Env: "PROMPTC_PROVIDERS", Key: "routing.providers", parse: parseList},
+	{Env: "PROMPTC_HEDGE_DELAY", Key: "routing.hedge_delay"},
+	{Env: "PROMPTC_OPTIMIZE_TIMEOUT", Key: "routing.optimize_timeout"},
+	{Env: "PROMPTC_TEAM", Key: "routing.team"},
+	{Env: "PROMPTC_INSTRUCTIONS_DIR", Key: "routing.instructions_dir"},
+	{Env: "PROMPTC_WORKERS", Key: "limits.workers"},
+	{Env: "PROMPTC_QUEUE", Key: "limits.queue"},
+	{Env: "PROMPTC_CLIENT_RPM", Key: "limits.client_rpm"},
+	{Env: "PROMPTC_CACHE", Key: "cache.mode"},
+	{Env: "PROMPTC_CACHE_TTL", Key: "cache.ttl"},
+	{Env: "PROMPTC_DASHBOARD", Key: "dashboard.enabled", parse: parseFlag},
+	{Env: "PROMPTC_DASHBOARD_ADDR", Key: "dashboard.addr"},
+	{Env: "PROMPTC_AUDIT_STDERR", Key: "audit.stderr", parse: parseFlag},
+	{Env: "PROMPTC_MIN_SCORE", Key: "analyzer.min_score"},
+	{Env: "PROMPTC_LANGUAGE", Key: "analyzer.language"},
+}
+
+// EnvKeys lista las variables de entorno reconocidas y su clave.
+func EnvKeys() map[string]string {
+	out := make(map[string]string, len(envKeys))
+	for _, e := range envKeys {
+		out[e.Env] = e.Key
+	}
+	return out
+}
+
+func parseList(v string) interface{} {
+	var out []interface{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parseFlag acepta 1/0 además de true/false, como las variables históricas.
+func parseFlag(v string) interface{} {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	return v // que falle la validación con el valor original
+}
+
+// parseScalar interpreta un valor de --set o del entorno como YAML:
+// "4" es entero, "[a, b]" es lista, "30s" queda como texto.
+func parseScalar(v string) interface{} {
+	var out interface{}
+	if err := yaml.Unmarshal([]byte(v), &out); err != nil || out == nil {
+		return v
+	}
+	return out
+}
+
+// layer es una capa con su origen, para los mensajes de error.
+type layer struct {
+	source string
+	values map[string]interface{}
+}
+
+// Resolve arma la configuración efectiva y la valida.
+func Resolve(opts Options) (AppConfig, error) {
+	_, cfg, err := resolve(opts)
+	return cfg, err
+}
+
+// ResolveMap es Resolve como mapa genérico, para config get y show.
+func ResolveMap(opts Options) (map[string]interface{}, error) {
+	merged, _, err := resolve(opts)
+	return merged, err
+}
+
+func resolve(opts Options) (map[string]interface{}, AppConfig, error) {
+	path, err := getConfigPath()
+	if err != nil {
+		return nil, AppConfig{}, err
+	}
+	data, err := readFile()
+	if err != nil {
+		return nil, AppConfig{}, err
+	}
+	return resolveData(opts, path, data)
+}
+
+// resolveData aplica las capas sobre el contenido data del archivo path.
+func resolveData(opts Options, path string, data []byte) (map[string]interface{}, AppConfig, error) {
+	getenv := opts.Getenv
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+	if err := decodeStrict(data, &AppConfig{}); err != nil {
+		return nil, AppConfig{}, fmt.Errorf("%s: %s", path, cleanYAMLError(err, true))
+	}
+	file := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, AppConfig{}, err
+	}
+	if file == nil {
+		file = map[string]interface{}{}
+	}
+
+	defaults, err := toMap(Defaults())
+	if err != nil {
+		return nil, AppConfig{}, err
+	}
+	layers := []layer{{source: "defaults", values: defaults}}
+
+	profile := opts.Profile
+	if profile == "" {
+		profile = getenv("PROMPTC_PROFILE")
+	}
+	if profile == "" {
+		profile, _ = file["profile"].(string)
+	}
+	fileProfiles, _ := file["profiles"].(map[string]interface{})
+	base := map[string]interface{}{}
+	for k, v := range file {
+		if k != "profiles" {
+			base[k] = v
+		}
+	}
+	layers = append(layers, layer{source: path, values: base})
+
+	if profile != "" {
+		builtin, isBuiltin := builtinProfiles[profile]
+		custom, isCustom := fileProfiles[profile].(map[string]interface{})
+		if !isBuiltin && !isCustom {
+			return nil, AppConfig{}, fmt.Errorf("perfil %q no existe (disponibles: %s)", profile, strings.Join(profileNames(file), ", "))
+		}
+		if isBuiltin {
+			layers = append(layers, layer{source: "perfil " + profile, values: copyMap(builtin)})
+		}
+		if isCustom {
+			layers = append(layers, layer{source: fmt.Sprintf("%s perfil %s", path, profile), values: custom})
+		}
+	}
+
+	for _, e := range envKeys {
+		v := getenv(e.Env)
+		if v == "" {
+			continue
+		}
+		parse := e.parse
+		if parse == nil {
+			parse = parseScalar
+		}
+		values := map[string]interface{}{}
+		setPath(values, e.Key, parse(v))
+		layers = append(layers, layer{source: e.Env, values: values})
+	}
+
+	for _, o := range opts.Overrides {
+		key, value, ok := strings.Cut(o, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, AppConfig{}, fmt.Errorf("--set %q: se esperaba clave=valor", o)
+		}
+		values := map[string]interface{}{}
+		setPath(values, strings.TrimSpace(key), parseScalar(value))
+		layers = append(layers, layer{source: "--set " + key, values: values})
+	}
+
+	merged := map[string]interface{}{}
+	for _, l := range layers {
+		if err := decodeMap(l.values, &AppConfig{}); err != nil {
+			return nil, AppConfig{}, fmt.Errorf("%s: %s", l.source, err)
+		}
+		merged = merge(merged, l.values)
+	}
+	if profile != "" {
+		merged["profile"] = profile
+	}
+	delete(merged, "profiles")
+
+	var cfg AppConfig
+	if err := decodeMap(merged, &cfg); err != nil {
+		return nil, AppConfig{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, AppConfig{}, err
+	}
+	return merged, cfg, nil
+}
+
+// ProfileNames lista los perfiles predefinidos y los declarados en config.yaml.
+func ProfileNames() ([]string, error) {
+	file, err := loadRaw()
+	if err != nil {
+		return nil, err
+	}
+	return profileNames(file), nil
+}
+
+func profileNames(file map[string]interface{}) []string {
+	seen := map[string]bool{}
+	for name := range builtinProfiles {
+		seen[name] = true
+	}
+	if profiles, ok := file["profiles"].(map[string]interface{}); ok {
+		for name := range profiles {
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get retorna el valor de una clave ("limits.workers") en la
+// configuración efectiva.
+func Get(opts Options, key string) (interface{}, error) {
+	merged, err := ResolveMap(opts)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := getPath(merged, key)
+	if !ok {
+		return nil, fmt.Errorf("clave %q no existe", key)
+	}
+	return v, nil
+}
+
+// Set escribe una clave en config.yaml (en profiles.<profile> si profile no
+// es vacío) después de comprobar que la configuración resultante es válida.
+// Las claves no tocadas se conservan; los comentarios del archivo no.
+func Set(profile, key, value string) error {
+	return Update(profile, map[string]string{key: value}, nil)
+}
+
+// Update es Set para varias claves a la vez, más las claves de unset que se
+// eliminan: se valida el resultado completo y el archivo se escribe una
+// sola vez, o no se escribe.
+func Update(profile string, set map[string]string, unset []string) error {
+	path, err := getConfigPath()
+	if err != nil {
+		return err
+	}
+	raw, err := loadRaw()
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if profile != "" {
+		prefix = "profiles." + profile + "."
+	}
+	for _, key := range unset {
+		deletePath(raw, prefix+key)
+	}
+	for key, value := range set {
+		var v interface{} = parseScalar(value)
+		if parts := strings.Split(key, "."); parts[len(parts)-1] == "api_key" || parts[0] == "keys" {
+			// Las keys y sus referencias son siempre texto: keyring:x o 1234
+			// no deben leerse como mapa o entero
+			v = value
+		}
+		setPath(raw, prefix+key, v)
+	}
+
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	// Sin entorno: se valida lo que queda escrito, no la sesión actual
+	noEnv := func(string) string { return "" }
+	if _, _, err := resolveData(Options{Profile: profile, Getenv: noEnv}, path, data); err != nil {
+		return err
+	}
+	return writeRaw(raw)
+}
+
+// --- MAPAS GENÉRICOS ---
+
+// toMap convierte un AppConfig al mapa genérico que produce su YAML.
+func toMap(cfg AppConfig) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]interface{}{}
+	err = yaml.Unmarshal(data, &out)
+	return out, err
+}
+
+// decodeMap decodifica un mapa genérico rechazando claves desconocidas.
+func decodeMap(m map[string]interface{}, out *AppConfig) error {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := decodeStrict(data, out); err != nil {
+		return fmt.Errorf("%s", cleanYAMLError(err, false))
+	}
+	return nil
+}
+
+func decodeStrict(data []byte, out *AppConfig) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	return dec.Decode(out)
+}
+
+var (
+	yamlLinePrefix = regexp.MustCompile(`line \d+: `)
+	yamlUnknown    = regexp.MustCompile("field (\\S+) not found in type (\\w+)\\.(\\w+)")
+	yamlType       = regexp.MustCompile("cannot unmarshal !!(\\w+) `([^`]*)` into (\\S+)")
+)
+
+// cleanYAMLError traduce los errores de yaml.v3. Las líneas solo se
+// conservan si el YAML es el archivo del usuario y no uno sintetizado.
+func cleanYAMLError(err error, keepLines bool) string {
+	msg := strings.TrimPrefix(err.Error(), "yaml: unmarshal errors:\n")
+	msg = strings.TrimPrefix(msg, "yaml: ")
+	var parts []string
+	for _, line := range strings.Split(msg, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !keepLines {
+			line = yamlLinePrefix.ReplaceAllString(line, "")
+		} else {
+			line = strings.Replace(line, "line ", "línea ", 1)
+		}
+		line = yamlUnknown.ReplaceAllStringFunc(line, func(m string) string {
+			sub := yamlUnknown.FindStringSubmatch(m)
+			return fmt.Sprintf("clave desconocida %q en %s", sub[1], sectionName(sub[3]))
+		})
+		line = yamlType.ReplaceAllString(line, "valor $2 ($1) no es del tipo esperado $3")
+		parts = append(parts, line)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// sectionName traduce el tipo Go de un error de yaml.v3 a la sección de
+// config.yaml: LimitsConfig -> limits.
+func sectionName(goType string) string {
+	if goType == "AppConfig" {
+		return "la raíz"
+	}
+	return "la sección " + strings.ToLower(strings.TrimSuffix(goType, "Config"))
+}
+
+// merge aplica over sobre base: los mapas se combinan por clave, el resto
+// (escalares y listas) se reemplaza.
+func merge(base, over map[string]interface{}) map[string]interface{} {
+	out := copyMap(base)
+	for k, v := range over {
+		if vm, ok := v.(map[string]interface{}); ok {
+			if bm, ok := out[k].(map[string]interface{}); ok {
+				out[k] = merge(bm, vm)
+				continue
+			}
+			out[k] = copyMap(vm)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if vm, ok := v.(map[string]interface{}); ok {
+			v = copyMap(vm)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func getPath(m map[string]interface{}, key string) (interface{}, bool) {
+	var cur interface{} = m
+	for _, part := range strings.Split(key, ".") {
+		node, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = node[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// deletePath elimina una clave; las secciones que quedan vacías se conservan.
+func deletePath(m map[string]interface{}, key string) {
+	parts := strings.Split(key, ".")
+	node := m
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := node[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		node = next
+	}
+	delete(node, parts[len(parts)-1])
+}
+
+func setPath(m map[string]interface{}, key string, v interface{}) {
+	parts := strings.Split(key, ".")
+	node := m
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := node[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			node[part] = next
+		}
+		node = next
+	}
+	node[parts[len(parts)-1]] = v
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveDataLayers(t *testing.T) {
+	const file = `
+provider: ollama
+limits:
+  workers: 4
+cache:
+  mode: disk
+profiles:
+  equipo:
+    limits:
+      queue: 20
+    cache:
+      mode: "off"
+`
+	cases := []struct {
+		name    string
+		data    string
+		opts    Options
+		env     map[string]string
+		check   func(t *testing.T, cfg AppConfig)
+		wantErr string
+	}{
+		{
+			name: "defaults sin archivo",
+			check: func(t *testing.T, cfg AppConfig) {
+				if cfg.Limits.Workers != 2 || cfg.Cache.Mode != "memory" || cfg.Routing.Mode != "sequential" {
+					t.Errorf("defaults = %+v %+v %+v", cfg.Limits, cfg.Cache, cfg.Routing)
+				}
+			},
+		},
+		{
+			name: "el archivo pisa solo lo que declara",
+			data: file,
+			check: func(t *testing.T, cfg AppConfig) {
+				if cfg.Limits.Workers != 4 || cfg.Limits.Queue != 8 || cfg.Cache.Mode != "disk" {
+					t.Errorf("limits = %+v cache = %+v", cfg.Limits, cfg.Cache)
+				}
+			},
+		},
+		{
+			name: "perfil del archivo sobre la base",
+			data: file,
+			opts: Options{Profile: "equipo"},
+			check: func(t *testing.T, cfg AppConfig) {
+				if cfg.Profile != "equipo" || cfg.Limits.Workers != 4 || cfg.Limits.Queue != 20 || cfg.Cache.Mode != "off" {
+					t.Errorf("profile = %q limits = %+v cache = %+v", cfg.Profile, cfg.Limits, cfg.Cache)
+				}
+			},
+		},
+		{
+			name: "perfil predefinido desde PROMPTC_PROFILE",
+			data: file,
+			env:  map[string]string{"PROMPTC_PROFILE": "prod"},
+			check: func(t *testing.T, cfg AppConfig) {
+				if cfg.Profile != "prod" || cfg.Routing.Mode != "hedged" {
+					t.Errorf("profile = %q routing = %+v", cfg.Profile, cfg.Routing)
+				}
+			},
+		},
+		{
+			name: "el entorno pisa al perfil y --set al entorno",
+			data: file,
+			opts: Options{Profile: "equipo", Overrides: []string{"limits.queue=3", "routing.hedge_delay=2s"}},
+			env: map[string]string{
+				"PROMPTC_QUEUE":     "12",
+				"PROMPTC_WORKERS":   "6",
+				"PROMPTC_PROVIDERS": "gemini, ollama",
+			},
+			check: func(t *testing.T, cfg AppConfig) {
+				if cfg.Limits.Workers != 6 || cfg.Limits.Queue != 3 {
+					t.Errorf("limits = %+v", cfg.Limits)
+				}
+				if time.Duration(cfg.Routing.HedgeDelay) != 2*time.Second {
+					t.Errorf("hedge_delay = %v", time.Duration(cfg.Routing.HedgeDelay))
+				}
+				if !slices.Equal(cfg.Routing.Providers, []string{"gemini", "ollama"}) {
+					t.Errorf("providers = %v", cfg.Routing.Providers)
+				}
+			},
+		},
+		{
+			name: "--set interpreta listas y booleanos",
+			opts: Options{Overrides: []string{"routing.providers=[gemini]", "dashboard.enabled=false"}},
+			check: func(t *testing.T, cfg AppConfig) {
+				if !slices.Equal(cfg.Routing.Providers, []string{"gemini"}) || cfg.Dashboard.Enabled {
+					t.Errorf("providers = %v dashboard = %+v", cfg.Routing.Providers, cfg.Dashboard)
+				}
+			},
+		},
+		{
+			name:    "--set sin igual",
+			opts:    Options{Overrides: []string{"limits.workers"}},
+			wantErr: `--set "limits.workers": se esperaba clave=valor`,
+		},
+		{
+			name:    "perfil inexistente",
+			data:    file,
+			opts:    Options{Profile: "staging"},
+			wantErr: `perfil "staging" no existe`,
+		},
+		{
+			name:    "clave desconocida en el archivo, con línea",
+			data:    "limits:\n  wokers: 4\n",
+			wantErr: `config.yaml: línea 2: clave desconocida "wokers" en la sección limits`,
+		},
+		{
+			name:    "tipo inválido en el archivo",
+			data:    "limits:\n  workers: muchos\n",
+			wantErr: "config.yaml: línea 2: valor muchos (str) no es del tipo esperado int",
+		},
+		{
+			name:    "tipo inválido en el entorno nombra la variable, sin línea",
+			env:     map[string]string{"PROMPTC_WORKERS": "muchos"},
+			wantErr: "PROMPTC_WORKERS: valor muchos (str) no es del tipo esperado int",
+		},
+		{
+			name:    "clave desconocida en --set",
+			opts:    Options{Overrides: []string{"cache.modo=disk"}},
+			wantErr: `--set cache.modo: clave desconocida "modo" en la sección cache`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.Getenv = func(key string) string { return tc.env[key] }
+			_, cfg, err := resolveData(opts, "config.yaml", []byte(tc.data))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, se esperaba %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveData: %v", err)
+			}
+			tc.check(t, cfg)
+		})
+	}
+}
+
+func TestCleanYAMLError(t *testing.T) {
+	cases := []struct {
+		in        string
+		keepLines bool
+		want      string
+	}{
+		{
+			in:        "yaml: unmarshal errors:\n  line 3: field wokers not found in type config.LimitsConfig",
+			keepLines: true,
+			want:      `línea 3: clave desconocida "wokers" en la sección limits`,
+		},
+		{
+			in:   "yaml: unmarshal errors:\n  line 1: field prvider not found in type config.AppConfig",
+			want: `clave desconocida "prvider" en la raíz`,
+		},
+		{
+			in:   "yaml: unmarshal errors:\n  line 2: cannot unmarshal !!str `muchos` into int\n  line 4: cannot unmarshal !!seq `` into string",
+			want: "valor muchos (str) no es del tipo esperado int; valor  (seq) no es del tipo esperado string",
+		},
+	}
+	for _, tc := range cases {
+		if got := cleanYAMLError(errors.New(tc.in), tc.keepLines); got != tc.want {
+			t.Errorf("cleanYAMLError(%q) = %q, se esperaba %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/andesdevroot/promptc/internal/secrets"
+	"github.com/andesdevroot/promptc/pkg/sdk"
+)
+
+// ValidationError reúne todos los problemas de una configuración, para
+// corregirlos de una vez y no de a uno por arranque.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "configuración inválida:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate revisa rangos y valores permitidos de la configuración efectiva.
+func (c AppConfig) Validate() error {
+	var problems []string
+	bad := func(key, format string, args ...interface{}) {
+		problems = append(problems, key+": "+fmt.Sprintf(format, args...))
+	}
+
+	known := strings.Join(sdk.Providers, "|")
+	if c.Provider != "" && !slices.Contains(sdk.Providers, c.Provider) {
+		bad("provider", "%q no soportado (%s)", c.Provider, known)
+	}
+	if err := secrets.Check(c.APIKey); err != nil {
+		bad("api_key", "%v", err)
+	}
+	for _, name := range sortedKeys(c.Keys) {
+		if !slices.Contains(sdk.Providers, name) {
+			bad("keys."+name, "proveedor desconocido (%s)", known)
+			continue
+		}
+		if err := secrets.Check(c.Keys[name]); err != nil {
+			bad("keys."+name, "%v", err)
+		}
+	}
+
+	if c.Ollama.Port < 1 || c.Ollama.Port > 65535 {
+		bad("ollama.port", "%d fuera de rango (1-65535)", c.Ollama.Port)
+	}
+	if c.Ollama.Timeout <= 0 {
+		bad("ollama.timeout", "debe ser mayor que 0")
+	}
+	if c.OpenRouter.Timeout <= 0 {
+		bad("openrouter.timeout", "debe ser mayor que 0")
+	}
+
+	if _, err := sdk.ParseRoutingMode(c.Routing.Mode); err != nil {
+		bad("routing.mode", "%v", err)
+	}
+	seen := map[string]bool{}
+	for i, p := range c.Routing.Providers {
+		switch {
+		case !slices.Contains(sdk.Providers, p):
+			bad(fmt.Sprintf("routing.providers[%d]", i), "%q no soportado (%s)", p, known)
+		case seen[p]:
+			bad(fmt.Sprintf("routing.providers[%d]", i), "%q repetido", p)
+		}
+		seen[p] = true
+	}
+	if len(c.Routing.Providers) == 0 {
+		bad("routing.providers", "se requiere al menos un proveedor")
+	}
+	if seen["ollama"] && c.Ollama.Host == "" {
+		bad("ollama.host", "requerido mientras ollama esté en routing.providers")
+	}
+	if c.Routing.HedgeDelay < 0 {
+		bad("routing.hedge_delay", "no puede ser negativo")
+	}
+	if c.Routing.OptimizeTimeout < 0 {
+		bad("routing.optimize_timeout", "no puede ser negativo")
+	}
+
+	if c.Limits.Workers < 1 {
+		bad("limits.workers", "debe ser al menos 1 (valor %d)", c.Limits.Workers)
+	}
+	if c.Limits.Queue < 0 {
+		bad("limits.queue", "no puede ser negativo (valor %d)", c.Limits.Queue)
+	}
+	if c.Limits.ClientRPM < 0 {
+		bad("limits.client_rpm", "no puede ser negativo (0 desactiva el límite)")
+	}
+
+	switch c.Cache.Mode {
+	case "memory", "disk", "off":
+	default:
+		bad("cache.mode", "%q desconocido (memory|disk|off)", c.Cache.Mode)
+	}
+	if c.Cache.Mode != "off" && c.Cache.TTL <= 0 {
+		bad("cache.ttl", "debe ser mayor que 0")
+	}
+
+	if c.Dashboard.Enabled {
+		if _, _, err := net.SplitHostPort(c.Dashboard.Addr); err != nil {
+			bad("dashboard.addr", "%q no es host:puerto (ej: :8080, 127.0.0.1:8080)", c.Dashboard.Addr)
+		}
+	}
+
+	if c.Analyzer.MinScore < 0 || c.Analyzer.MinScore > 100 {
+		bad("analyzer.min_score", "%d fuera de rango (0-100)", c.Analyzer.MinScore)
+	}
+	switch c.Analyzer.Language {
+	case "es", "en":
+	default:
+		bad("analyzer.language", "%q no soportado (es|en)", c.Analyzer.Language)
+	}
+
+	if err := c.Billing.Validate(); err != nil {
+		bad("billing", "%v", err)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Warnings reporta lo que es válido pero no recomendable: hoy, las API keys
+// guardadas en texto plano en vez de una referencia.
+func (c AppConfig) Warnings() []string {
+	var warnings []string
+	plain := func(key, value string) {
+		if secrets.Plaintext(value) {
+			warnings = append(warnings, key+": API key en texto plano; use una referencia (env:, file:, cmd:, keyring: o vault:)")
+		}
+	}
+	plain("api_key", c.APIKey)
+	for _, name := range sortedKeys(c.Keys) {
+		plain("keys."+name, c.Keys[name])
+	}
+	return warnings
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,84 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// El llavero del sistema se consulta con las herramientas del propio SO:
+// security (Keychain) en macOS y secret-tool (Secret Service: GNOME
+// Keyring, KWallet) en Linux. Así el binario no enlaza librerías nativas.
+
+// KeyringService es el servicio por defecto de keyring:<cuenta>.
+const KeyringService = "promptc"
+
+// splitKeyring separa servicio/cuenta; sin servicio usa KeyringService.
+func splitKeyring(body string) (service, account string, err error) {
+	service, account, found := strings.Cut(body, "/")
+	if !found {
+		service, account = KeyringService, body
+	}
+	if service == "" || account == "" {
+		return "", "", fmt.Errorf("referencia keyring:%s inválida (keyring:servicio/cuenta)", body)
+	}
+	return service, account, nil
+}
+
+func keyringGet(ctx context.Context, body string) (string, error) {
+	service, account, err := splitKeyring(body)
+	if err != nil {
+		return "", err
+	}
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		c = exec.CommandContext(ctx, "security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux", "freebsd", "openbsd":
+		c = exec.CommandContext(ctx, "secret-tool", "lookup", "service", service, "account", account)
+	default:
+		return "", fmt.Errorf("llavero no soportado en %s", runtime.GOOS)
+	}
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+	if err := c.Run(); err != nil {
+		var notFound *exec.Error
+		if errors.As(err, &notFound) {
+			return "", fmt.Errorf("%s no está instalado", c.Args[0])
+		}
+		return "", errors.New("no existe en el llavero o está bloqueado")
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// KeyringSet guarda value en el llavero bajo servicio/cuenta (o solo cuenta).
+func KeyringSet(ctx context.Context, body, value string) error {
+	service, account, err := splitKeyring(body)
+	if err != nil {
+		return err
+	}
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// security no lee el secreto desde stdin sin una terminal: queda
+		// visible en la lista de procesos mientras dura la llamada
+		c = exec.CommandContext(ctx, "security", "add-generic-password", "-U", "-s", service, "-a", account, "-w", value)
+	case "linux", "freebsd", "openbsd":
+		c = exec.CommandContext(ctx, "secret-tool", "store", "--label", service+"/"+account, "service", service, "account", account)
+		c.Stdin = strings.NewReader(value)
+	default:
+		return fmt.Errorf("llavero no soportado en %s", runtime.GOOS)
+	}
+	if err := c.Run(); err != nil {
+		var notFound *exec.Error
+		if errors.As(err, &notFound) {
+			return fmt.Errorf("%s no está instalado", c.Args[0])
+		}
+		return fmt.Errorf("no se pudo guardar en el llavero: %w", err)
+	}
+	return nil
+}
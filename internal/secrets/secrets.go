@@ -0,0 +1,240 @@
+// Package secrets resuelve las API keys de config.yaml sin guardarlas en
+// texto plano. El valor de api_key o de keys.<proveedor> es una referencia:
+//
+//	env:GEMINI_API_KEY          variable de entorno
+//	file:/run/secrets/gemini    contenido del archivo, sin el salto de línea final
+//	cmd:pass show gemini        salida estándar del comando (sh -c)
+//	keyring:promptc/gemini      llavero del sistema: servicio/cuenta
+//	vault:gemini                bóveda cifrada local (ver Vault)
+//
+// Un valor sin esquema es una key literal: se acepta por compatibilidad con
+// los config.yaml anteriores, pero Plaintext la reporta para advertirlo.
+//
+// Cada valor resuelto queda registrado para Redact, que lo reemplaza en los
+// logs y eventos de auditoría antes de escribirlos.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Esquemas soportados en una referencia.
+const (
+	SchemeEnv     = "env"
+	SchemeFile    = "file"
+	SchemeCmd     = "cmd"
+	SchemeKeyring = "keyring"
+	SchemeVault   = "vault"
+)
+
+var schemes = []string{SchemeEnv, SchemeFile, SchemeCmd, SchemeKeyring, SchemeVault}
+
+// cmdTimeout acota los comandos cmd: un gestor de contraseñas que espera
+// una frase en la terminal no debe colgar el arranque.
+const cmdTimeout = 10 * time.Second
+
+// Masked es lo que se muestra en lugar de una key literal.
+const Masked = "********"
+
+// Split separa una referencia en esquema y cuerpo. ok es false si el valor
+// no empieza con un esquema conocido (es una key literal).
+func Split(ref string) (scheme, body string, ok bool) {
+	scheme, body, found := strings.Cut(ref, ":")
+	if !found {
+		return "", ref, false
+	}
+	for _, s := range schemes {
+		if scheme == s {
+			return scheme, body, true
+		}
+	}
+	return "", ref, false
+}
+
+// IsReference indica si el valor es una referencia y no una key literal.
+func IsReference(v string) bool {
+	_, _, ok := Split(v)
+	return ok
+}
+
+// Plaintext indica si el valor es una key literal no vacía.
+func Plaintext(v string) bool {
+	return v != "" && !IsReference(v)
+}
+
+// Check valida la forma de una referencia sin resolverla: no lee el
+// entorno, los archivos ni la bóveda.
+func Check(ref string) error {
+	scheme, body, ok := Split(ref)
+	if !ok {
+		return nil
+	}
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return fmt.Errorf("referencia %s: vacía", scheme)
+	}
+	if scheme == SchemeKeyring {
+		if _, _, err := splitKeyring(body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Mask retorna el valor apto para mostrar: las referencias no son secretas
+// y se muestran tal cual; las keys literales se reemplazan por Masked.
+func Mask(v string) string {
+	if Plaintext(v) {
+		return Masked
+	}
+	return v
+}
+
+// Resolver resuelve referencias. VaultPath ubica la bóveda para vault:;
+// Getenv permite inyectar el entorno (nil usa os.Getenv).
+type Resolver struct {
+	VaultPath string
+	Getenv    func(string) string
+}
+
+// Resolve retorna el secreto al que apunta ref; una key literal se retorna
+// tal cual. El valor queda registrado para Redact.
+func (r Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	scheme, body, ok := Split(ref)
+	if !ok {
+		Register(ref)
+		return ref, nil
+	}
+	if err := Check(ref); err != nil {
+		return "", err
+	}
+	body = strings.TrimSpace(body)
+
+	var value string
+	var err error
+	switch scheme {
+	case SchemeEnv:
+		value, err = r.env(body)
+	case SchemeFile:
+		value, err = readFile(body)
+	case SchemeCmd:
+		value, err = runCmd(ctx, body)
+	case SchemeKeyring:
+		value, err = keyringGet(ctx, body)
+	case SchemeVault:
+		value, err = r.vault(body)
+	}
+	if err != nil {
+		// El error nombra la referencia, nunca el valor
+		return "", fmt.Errorf("%s:%s: %w", scheme, body, err)
+	}
+	if value == "" {
+		return "", fmt.Errorf("%s:%s: el secreto está vacío", scheme, body)
+	}
+	Register(value)
+	return value, nil
+}
+
+func (r Resolver) env(name string) (string, error) {
+	getenv := r.Getenv
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+	v := getenv(name)
+	if v == "" {
+		return "", errors.New("variable de entorno no definida")
+	}
+	return v, nil
+}
+
+func (r Resolver) vault(name string) (string, error) {
+	if r.VaultPath == "" {
+		return "", errors.New("bóveda no configurada")
+	}
+	v, err := OpenVault(r.VaultPath, Passphrase(r.Getenv))
+	if err != nil {
+		return "", err
+	}
+	return v.Get(name)
+}
+
+func readFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// os.PathError ya incluye la ruta
+		var pe *os.PathError
+		if errors.As(err, &pe) {
+			return "", pe.Err
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// runCmd ejecuta el comando con sh -c y retorna su salida estándar sin el
+// salto de línea final. stderr se descarta del error: algunos gestores
+// imprimen ahí el secreto junto al diagnóstico.
+func runCmd(ctx context.Context, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, cmdTimeout)
+	defer cancel()
+	var stdout bytes.Buffer
+	c := exec.CommandContext(ctx, "sh", "-c", command)
+	c.Stdout = &stdout
+	if err := c.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("el comando no terminó en %s", cmdTimeout)
+		}
+		return "", fmt.Errorf("el comando falló: %w", err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// --- REDACCIÓN ---
+
+// minRedact evita reemplazar valores tan cortos que aparecerían por azar en
+// cualquier línea de log.
+const minRedact = 6
+
+// Redacted reemplaza a un secreto en los logs.
+const Redacted = "[secreto]"
+
+var registry struct {
+	sync.RWMutex
+	values []string
+}
+
+// Register agrega un valor a los que Redact oculta. Las keys que llegan por
+// otra vía que Resolve (ej: GEMINI_API_KEY) se registran con esta función.
+func Register(value string) {
+	if len(value) < minRedact {
+		return
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	for _, v := range registry.values {
+		if v == value {
+			return
+		}
+	}
+	registry.values = append(registry.values, value)
+}
+
+// Redact reemplaza en s cada secreto registrado.
+func Redact(s string) string {
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, v := range registry.values {
+		if strings.Contains(s, v) {
+			s = strings.ReplaceAll(s, v, Redacted)
+		}
+	}
+	return s
+}
@@ -0,0 +1,191 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// La bóveda es un archivo JSON con los secretos cifrados en un solo bloque
+// AES-256-GCM. La clave se deriva con PBKDF2-SHA256 de la frase de
+// PROMPTC_VAULT_PASSPHRASE y una sal aleatoria por archivo; cada escritura
+// usa un nonce nuevo. Sin la frase el archivo no revela ni los nombres.
+
+// PassphraseEnv es la variable con la frase de la bóveda.
+const PassphraseEnv = "PROMPTC_VAULT_PASSPHRASE"
+
+const (
+	vaultVersion    = 1
+	vaultIterations = 600_000 // recomendación OWASP para PBKDF2-SHA256
+	vaultSaltSize   = 16
+	vaultKeySize    = 32
+)
+
+// ErrNoPassphrase indica que falta PROMPTC_VAULT_PASSPHRASE.
+var ErrNoPassphrase = errors.New("defina " + PassphraseEnv + " para abrir la bóveda")
+
+// ErrWrongPassphrase indica que la frase no descifra la bóveda (o que el
+// archivo fue alterado: GCM no distingue ambos casos).
+var ErrWrongPassphrase = errors.New("frase incorrecta o bóveda alterada")
+
+// vaultFile es el formato en disco.
+type vaultFile struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// Vault es una bóveda abierta. Los cambios quedan en memoria hasta Save.
+type Vault struct {
+	path       string
+	passphrase string
+	salt       []byte
+	iterations int
+	secrets    map[string]string
+}
+
+// Passphrase lee la frase del entorno (getenv nil usa os.Getenv).
+func Passphrase(getenv func(string) string) string {
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+	return getenv(PassphraseEnv)
+}
+
+// OpenVault descifra la bóveda de path. Si el archivo no existe retorna
+// una bóveda vacía que se crea con el primer Save.
+func OpenVault(path, passphrase string) (*Vault, error) {
+	if passphrase == "" {
+		return nil, ErrNoPassphrase
+	}
+	v := &Vault{path: path, passphrase: passphrase, iterations: vaultIterations, secrets: map[string]string{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f vaultFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("bóveda %s ilegible: %w", path, err)
+	}
+	if f.Version != vaultVersion {
+		return nil, fmt.Errorf("bóveda %s: versión %d no soportada", path, f.Version)
+	}
+	if f.Iterations < 1 || len(f.Salt) == 0 {
+		return nil, fmt.Errorf("bóveda %s ilegible: faltan sal o iteraciones", path)
+	}
+	gcm, err := vaultCipher(passphrase, f.Salt, f.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != gcm.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	if err := json.Unmarshal(plain, &v.secrets); err != nil {
+		return nil, fmt.Errorf("bóveda %s ilegible: %w", path, err)
+	}
+	v.salt, v.iterations = f.Salt, f.Iterations
+	return v, nil
+}
+
+func vaultCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, vaultKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Get retorna el secreto name.
+func (v *Vault) Get(name string) (string, error) {
+	s, ok := v.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("no existe en la bóveda %s", v.path)
+	}
+	return s, nil
+}
+
+// Set agrega o reemplaza el secreto name.
+func (v *Vault) Set(name, value string) {
+	v.secrets[name] = value
+}
+
+// Delete elimina el secreto name; false si no existía.
+func (v *Vault) Delete(name string) bool {
+	_, ok := v.secrets[name]
+	delete(v.secrets, name)
+	return ok
+}
+
+// Names retorna los nombres de los secretos, ordenados.
+func (v *Vault) Names() []string {
+	names := make([]string, 0, len(v.secrets))
+	for name := range v.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save cifra y escribe la bóveda con permisos 0600. Se escribe a un archivo
+// temporal y se renombra: un corte a mitad no deja la bóveda ilegible.
+func (v *Vault) Save() error {
+	if v.salt == nil {
+		v.salt = make([]byte, vaultSaltSize)
+		if _, err := rand.Read(v.salt); err != nil {
+			return err
+		}
+	}
+	gcm, err := vaultCipher(v.passphrase, v.salt, v.iterations)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	plain, err := json.Marshal(v.secrets)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(vaultFile{
+		Version:    vaultVersion,
+		Iterations: v.iterations,
+		Salt:       v.salt,
+		Nonce:      nonce,
+		Data:       gcm.Seal(nil, nonce, plain, nil),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(v.path), 0700); err != nil {
+		return err
+	}
+	tmp := v.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, v.path)
+}
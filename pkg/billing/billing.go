@@ -0,0 +1,122 @@
+// Package billing convierte los tokens de cada inferencia en dinero y
+// aplica presupuestos diarios y mensuales por template y por cliente.
+package billing
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+)
+
+// ErrBudgetExceeded se retorna cuando un presupuesto con on_exceed=refuse se agotó.
+var ErrBudgetExceeded = errors.New("presupuesto agotado")
+
+// Price es el costo en USD por cada 1K tokens de un modelo.
+type Price struct {
+	InputPer1K  float64 `yaml:"input_per_1k" json:"input_per_1k"`
+	OutputPer1K float64 `yaml:"output_per_1k" json:"output_per_1k"`
+}
+
+// Cost calcula el costo de una inferencia con este precio.
+func (p Price) Cost(inputTokens, outputTokens int64) float64 {
+	return float64(inputTokens)/1000*p.InputPer1K + float64(outputTokens)/1000*p.OutputPer1K
+}
+
+// Free indica un modelo sin costo marginal (nodo local).
+func (p Price) Free() bool { return p.InputPer1K == 0 && p.OutputPer1K == 0 }
+
+// DefaultPrices cubre los modelos que el SDK registra por defecto. La
+// sección billing.prices de config.yaml los sobrescribe modelo a modelo.
+var DefaultPrices = map[string]Price{
+	"llama3":                      {},
+	"gemini-2.0-flash":            {InputPer1K: 0.0001, OutputPer1K: 0.0004},
+	"gemini-2.5-flash":            {InputPer1K: 0.0003, OutputPer1K: 0.0025},
+	"gemini-2.5-pro":              {InputPer1K: 0.00125, OutputPer1K: 0.01},
+	"anthropic/claude-3.5-sonnet": {InputPer1K: 0.003, OutputPer1K: 0.015},
+}
+
+// Scope indica a qué dimensión del Caller aplica un presupuesto.
+type Scope string
+
+const (
+	ScopeTemplate Scope = "template"
+	ScopeClient   Scope = "client"
+)
+
+// Action es lo que hace el router al agotarse un presupuesto.
+type Action string
+
+const (
+	Allow Action = "allow"
+	// LocalOnly restringe la cadena a modelos de precio cero (nodo local).
+	LocalOnly Action = "local"
+	// Refuse rechaza la optimización con ErrBudgetExceeded.
+	Refuse Action = "refuse"
+)
+
+// Budget limita el gasto de un template o cliente. Un límite en 0 no aplica.
+type Budget struct {
+	Scope    Scope   `yaml:"scope" json:"scope"`
+	Name     string  `yaml:"name" json:"name"`
+	Daily    float64 `yaml:"daily,omitempty" json:"daily,omitempty"`
+	Monthly  float64 `yaml:"monthly,omitempty" json:"monthly,omitempty"`
+	OnExceed Action  `yaml:"on_exceed,omitempty" json:"on_exceed,omitempty"` // local (default) | refuse
+}
+
+// Config es la sección billing de ~/.promptc/config.yaml.
+type Config struct {
+	Prices  map[string]Price `yaml:"prices,omitempty"`
+	Budgets []Budget         `yaml:"budgets,omitempty"`
+}
+
+// Validate revisa scopes y acciones antes de arrancar el router.
+func (c Config) Validate() error {
+	for i, b := range c.Budgets {
+		if b.Scope != ScopeTemplate && b.Scope != ScopeClient {
+			return fmt.Errorf("budgets[%d]: scope %q inválido (template|client)", i, b.Scope)
+		}
+		if b.Name == "" {
+			return fmt.Errorf("budgets[%d]: falta name", i)
+		}
+		switch b.OnExceed {
+		case "", LocalOnly, Refuse:
+		default:
+			return fmt.Errorf("budgets[%d]: on_exceed %q inválido (local|refuse)", i, b.OnExceed)
+		}
+	}
+	return nil
+}
+
+// Decision es el veredicto del router para una solicitud.
+type Decision struct {
+	Action Action
+	Budget Budget
+	Period string  // "daily" | "monthly"
+	Spent  float64 // gasto acumulado en el período
+	Limit  float64
+}
+
+func (d Decision) String() string {
+	return fmt.Sprintf("%s=%s %s $%.4f/$%.4f → %s", d.Budget.Scope, d.Budget.Name, d.Period, d.Spent, d.Limit, d.Action)
+}
+
+// Charge es el cargo de una inferencia, ya valorizado.
+type Charge struct {
+	Template string
+	Client   string
+	Provider string
+	Model    string
+	Cost     float64
+}
+
+// ChargeFor valoriza la procedencia de una optimización con la tabla de precios.
+func (l *Ledger) ChargeFor(template, client string, p core.Provenance) Charge {
+	return Charge{
+		Template: template,
+		Client:   client,
+		Provider: p.Provider,
+		Model:    p.Model,
+		Cost:     l.Price(p.Model).Cost(p.InputTokens, p.OutputTokens),
+	}
+}
@@ -0,0 +1,227 @@
+package billing
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spend acumula gasto en USD con corte diario y mensual.
+type Spend struct {
+	Day     string  `json:"day"`   // 2006-01-02 del acumulado diario
+	Daily   float64 `json:"daily"` // gasto del día Day
+	Month   string  `json:"month"` // 2006-01 del acumulado mensual
+	Monthly float64 `json:"monthly"`
+	Total   float64 `json:"total"` // histórico, nunca se reinicia
+}
+
+// roll reinicia los acumulados si cambió el día o el mes.
+func (s *Spend) roll(now time.Time) {
+	if day := now.Format("2006-01-02"); s.Day != day {
+		s.Day, s.Daily = day, 0
+	}
+	if month := now.Format("2006-01"); s.Month != month {
+		s.Month, s.Monthly = month, 0
+	}
+}
+
+func (s *Spend) add(now time.Time, cost float64) {
+	s.roll(now)
+	s.Daily += cost
+	s.Monthly += cost
+	s.Total += cost
+}
+
+// Ledger lleva el gasto por template, cliente y modelo, y decide si una
+// solicitud puede seguir usando modelos pagados.
+type Ledger struct {
+	mu      sync.Mutex
+	prices  map[string]Price
+	budgets []Budget
+	spend   map[string]*Spend // "template:<name>", "client:<name>", "model:<name>", "total"
+}
+
+// NewLedger combina DefaultPrices con los precios de la configuración.
+func NewLedger(cfg Config) *Ledger {
+	prices := make(map[string]Price, len(DefaultPrices)+len(cfg.Prices))
+	for m, p := range DefaultPrices {
+		prices[m] = p
+	}
+	for m, p := range cfg.Prices {
+		prices[m] = p
+	}
+	return &Ledger{prices: prices, budgets: cfg.Budgets, spend: make(map[string]*Spend)}
+}
+
+// Price retorna el precio del modelo; cero si no está en la tabla.
+func (l *Ledger) Price(model string) Price {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.prices[model]
+}
+
+// IsFree indica si el modelo está en la tabla con precio cero. Un modelo
+// desconocido no se considera gratis: no se usa como fallback local.
+func (l *Ledger) IsFree(model string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p, ok := l.prices[model]
+	return ok && p.Free()
+}
+
+// Check evalúa los presupuestos que aplican al template y al cliente. Si
+// varios están agotados gana la acción más restrictiva.
+func (l *Ledger) Check(template, client string) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	d := Decision{Action: Allow}
+	for _, b := range l.budgets {
+		name := template
+		if b.Scope == ScopeClient {
+			name = client
+		}
+		if name == "" || name != b.Name {
+			continue
+		}
+		s := l.account(string(b.Scope) + ":" + b.Name)
+		s.roll(now)
+		action := b.OnExceed
+		if action == "" {
+			action = LocalOnly
+		}
+		if d.Action == Refuse || (d.Action == LocalOnly && action == LocalOnly) {
+			continue
+		}
+		switch {
+		case b.Daily > 0 && s.Daily >= b.Daily:
+			d = Decision{Action: action, Budget: b, Period: "daily", Spent: s.Daily, Limit: b.Daily}
+		case b.Monthly > 0 && s.Monthly >= b.Monthly:
+			d = Decision{Action: action, Budget: b, Period: "monthly", Spent: s.Monthly, Limit: b.Monthly}
+		}
+	}
+	return d
+}
+
+// Record suma un cargo a todas sus dimensiones.
+func (l *Ledger) Record(c Charge) {
+	if c.Cost <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.account("total").add(now, c.Cost)
+	if c.Model != "" {
+		l.account("model:"+c.Model).add(now, c.Cost)
+	}
+	if c.Template != "" {
+		l.account("template:"+c.Template).add(now, c.Cost)
+	}
+	if c.Client != "" {
+		l.account("client:"+c.Client).add(now, c.Cost)
+	}
+}
+
+func (l *Ledger) account(key string) *Spend {
+	s, ok := l.spend[key]
+	if !ok {
+		s = &Spend{}
+		l.spend[key] = s
+	}
+	return s
+}
+
+// BudgetStatus es un presupuesto con su consumo actual, para el dashboard.
+type BudgetStatus struct {
+	Budget
+	SpentDaily   float64 `json:"spent_daily"`
+	SpentMonthly float64 `json:"spent_monthly"`
+}
+
+// Snapshot es el gasto agrupado que expone /api/metrics.
+type Snapshot struct {
+	Today     float64          `json:"today"`
+	Month     float64          `json:"month"`
+	Total     float64          `json:"total"`
+	Models    map[string]Spend `json:"models"`
+	Templates map[string]Spend `json:"templates"`
+	Clients   map[string]Spend `json:"clients"`
+	Budgets   []BudgetStatus   `json:"budgets"`
+	Prices    map[string]Price `json:"prices"`
+}
+
+func (l *Ledger) Snapshot() Snapshot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	snap := Snapshot{
+		Models:    map[string]Spend{},
+		Templates: map[string]Spend{},
+		Clients:   map[string]Spend{},
+		Prices:    make(map[string]Price, len(l.prices)),
+	}
+	for key, s := range l.spend {
+		s.roll(now)
+		kind, name, _ := strings.Cut(key, ":")
+		switch kind {
+		case "total":
+			snap.Today, snap.Month, snap.Total = s.Daily, s.Monthly, s.Total
+		case "model":
+			snap.Models[name] = *s
+		case "template":
+			snap.Templates[name] = *s
+		case "client":
+			snap.Clients[name] = *s
+		}
+	}
+	for _, b := range l.budgets {
+		st := BudgetStatus{Budget: b}
+		if s, ok := l.spend[string(b.Scope)+":"+b.Name]; ok {
+			st.SpentDaily, st.SpentMonthly = s.Daily, s.Monthly
+		}
+		snap.Budgets = append(snap.Budgets, st)
+	}
+	sort.Slice(snap.Budgets, func(i, j int) bool { return snap.Budgets[i].Name < snap.Budgets[j].Name })
+	for m, p := range l.prices {
+		snap.Prices[m] = p
+	}
+	return snap
+}
+
+// Load restaura el gasto persistido; un archivo inexistente no es error.
+func (l *Ledger) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	spend := map[string]*Spend{}
+	if err := json.Unmarshal(data, &spend); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.spend = spend
+	l.mu.Unlock()
+	return nil
+}
+
+// Save persiste el gasto con rename atómico, igual que metrics.json.
+func (l *Ledger) Save(path string) error {
+	l.mu.Lock()
+	data, err := json.MarshalIndent(l.spend, "", "  ")
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketName = []byte("optimizations")
+
+// Bolt es un Store en disco sobre bbolt: sobrevive reinicios del servidor
+// MCP, que Claude Desktop relanza en cada sesión.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt abre (o crea) la base en path. Si otro proceso la tiene
+// bloqueada, falla tras un segundo en vez de colgar el arranque.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+func (b *Bolt) Get(key string) (Entry, bool, error) {
+	var e Entry
+	var found bool
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketName).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &e)
+	})
+	if err != nil {
+		return Entry{}, false, err
+	}
+	return e, found, nil
+}
+
+func (b *Bolt) Put(key string, e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Put([]byte(key), data)
+	})
+}
+
+func (b *Bolt) Delete(key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Delete([]byte(key))
+	})
+}
+
+func (b *Bolt) DeleteWhere(match func(Entry) bool) (int, error) {
+	n := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketName).Cursor()
+		for k, v := c.First(); k != nil; {
+			var e Entry
+			key := append([]byte(nil), k...)
+			// Una entrada ilegible (formato viejo) también se descarta
+			if json.Unmarshal(v, &e) != nil || match(e) {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				n++
+				// Tras Delete el cursor ya apunta al siguiente elemento
+				k, v = c.Seek(key)
+				continue
+			}
+			k, v = c.Next()
+		}
+		return nil
+	})
+	return n, err
+}
+
+func (b *Bolt) Len() int {
+	n := 0
+	_ = b.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(bucketName).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+func (b *Bolt) Close() error { return b.db.Close() }
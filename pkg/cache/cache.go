@@ -0,0 +1,203 @@
+// Package cache guarda optimizaciones ya aceptadas para no volver a gastar
+// GPU local ni cuota de Gemini en la misma combinación de template y variables.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+)
+
+// Entry es una optimización guardada. Template permite invalidar todas las
+// entradas derivadas de un template cuando su contenido cambia.
+type Entry struct {
+	Optimization core.Optimization `json:"optimization"`
+	Template     string            `json:"template,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	ExpiresAt    time.Time         `json:"expires_at,omitempty"`
+}
+
+// Expired indica si la entrada superó su TTL. Sin ExpiresAt no expira.
+func (e Entry) Expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
+
+// Store es el backend de almacenamiento: memoria (LRU) o disco (bbolt).
+type Store interface {
+	Get(key string) (Entry, bool, error)
+	Put(key string, e Entry) error
+	Delete(key string) error
+	// DeleteWhere borra las entradas que cumplen match y retorna cuántas fueron.
+	DeleteWhere(match func(Entry) bool) (int, error)
+	Len() int
+	Close() error
+}
+
+// Stats son los contadores que expone /api/metrics.
+type Stats struct {
+	Backend     string  `json:"backend"`
+	Entries     int     `json:"entries"`
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	Stores      int64   `json:"stores"`
+	Expired     int64   `json:"expired"`
+	Invalidated int64   `json:"invalidated"`
+	HitRatio    float64 `json:"hit_ratio"`
+}
+
+// Cache aplica TTL y lleva contadores sobre un Store. Los errores del
+// backend se registran y se tratan como miss: la caché nunca debe tumbar
+// una optimización.
+type Cache struct {
+	store   Store
+	backend string
+	TTL     time.Duration // 0 = sin expiración
+
+	hits, misses, stores, expired, invalidated int64
+}
+
+func New(store Store, backend string, ttl time.Duration) *Cache {
+	return &Cache{store: store, backend: backend, TTL: ttl}
+}
+
+// Get retorna la entrada si existe y no expiró, y la cuenta como un hit o
+// un miss. Las expiradas se borran al leerlas.
+func (c *Cache) Get(key string) (Entry, bool) {
+	e, ok := c.Peek(key)
+	c.RecordLookup(ok)
+	return e, ok
+}
+
+// Peek es Get sin contar hit ni miss: para una búsqueda que prueba varias
+// claves y registra su resultado una sola vez con RecordLookup.
+func (c *Cache) Peek(key string) (Entry, bool) {
+	e, ok, err := c.store.Get(key)
+	if err != nil {
+		log.Printf("[CACHE] Error leyendo %s: %v", key[:12], err)
+	}
+	if ok && e.Expired(time.Now()) {
+		atomic.AddInt64(&c.expired, 1)
+		_ = c.store.Delete(key)
+		ok = false
+	}
+	if !ok {
+		return Entry{}, false
+	}
+	return e, true
+}
+
+// RecordLookup cuenta una búsqueda como hit o miss en Stats.
+func (c *Cache) RecordLookup(hit bool) {
+	if hit {
+		atomic.AddInt64(&c.hits, 1)
+	} else {
+		atomic.AddInt64(&c.misses, 1)
+	}
+}
+
+// Put guarda una optimización aceptada con el TTL configurado.
+func (c *Cache) Put(key, template string, opt core.Optimization) {
+	now := time.Now()
+	e := Entry{Optimization: opt, Template: template, CreatedAt: now}
+	if c.TTL > 0 {
+		e.ExpiresAt = now.Add(c.TTL)
+	}
+	if err := c.store.Put(key, e); err != nil {
+		log.Printf("[CACHE] Error guardando %s: %v", key[:12], err)
+		return
+	}
+	atomic.AddInt64(&c.stores, 1)
+}
+
+// InvalidateTemplate borra todas las entradas derivadas del template.
+func (c *Cache) InvalidateTemplate(name string) int {
+	if name == "" {
+		return 0
+	}
+	return c.deleteWhere(func(e Entry) bool { return e.Template == name })
+}
+
+// Purge vacía la caché completa.
+func (c *Cache) Purge() int {
+	return c.deleteWhere(func(Entry) bool { return true })
+}
+
+func (c *Cache) deleteWhere(match func(Entry) bool) int {
+	n, err := c.store.DeleteWhere(match)
+	if err != nil {
+		log.Printf("[CACHE] Error invalidando: %v", err)
+	}
+	atomic.AddInt64(&c.invalidated, int64(n))
+	return n
+}
+
+func (c *Cache) Stats() Stats {
+	s := Stats{
+		Backend:     c.backend,
+		Entries:     c.store.Len(),
+		Hits:        atomic.LoadInt64(&c.hits),
+		Misses:      atomic.LoadInt64(&c.misses),
+		Stores:      atomic.LoadInt64(&c.stores),
+		Expired:     atomic.LoadInt64(&c.expired),
+		Invalidated: atomic.LoadInt64(&c.invalidated),
+	}
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRatio = float64(s.Hits) / float64(total) * 100
+	}
+	return s
+}
+
+func (c *Cache) Close() error { return c.store.Close() }
+
+// Key direcciona una optimización por contenido: el prompt normalizado, la
+// versión de la instrucción y el proveedor/modelo que la produciría. El ID y
+// la versión del prompt no participan; dos prompts con el mismo contenido
+// comparten la entrada.
+func Key(p core.Prompt, instVersion, provider, model string) string {
+	type vars struct {
+		K, V string
+	}
+	norm := struct {
+		Role        string   `json:"role"`
+		Context     string   `json:"context"`
+		Task        string   `json:"task"`
+		Constraints []string `json:"constraints"`
+		Variables   []vars   `json:"variables"`
+		Instruction string   `json:"instruction"`
+		Provider    string   `json:"provider"`
+		Model       string   `json:"model"`
+	}{
+		Role:        collapse(p.Role),
+		Context:     collapse(p.Context),
+		Task:        collapse(p.Task),
+		Instruction: instVersion,
+		Provider:    provider,
+		Model:       model,
+	}
+	for _, c := range p.Constraints {
+		if c = collapse(c); c != "" {
+			norm.Constraints = append(norm.Constraints, c)
+		}
+	}
+	for k, v := range p.Variables {
+		norm.Variables = append(norm.Variables, vars{K: strings.TrimSpace(k), V: collapse(v)})
+	}
+	sort.Slice(norm.Variables, func(i, j int) bool { return norm.Variables[i].K < norm.Variables[j].K })
+
+	data, _ := json.Marshal(norm)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// collapse recorta y colapsa espacios, para que un salto de línea extra en
+// el template no genere una clave distinta.
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
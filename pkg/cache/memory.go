@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Memory es un Store LRU en memoria con un máximo de entradas.
+type Memory struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // frente = usada más recientemente
+	entries map[string]*list.Element
+}
+
+type memoryItem struct {
+	key   string
+	entry Entry
+}
+
+// NewMemory crea un LRU; max <= 0 deja la caché sin límite de tamaño.
+func NewMemory(max int) *Memory {
+	return &Memory{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (m *Memory) Get(key string) (Entry, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.entries[key]
+	if !ok {
+		return Entry{}, false, nil
+	}
+	m.order.MoveToFront(el)
+	return el.Value.(*memoryItem).entry, true, nil
+}
+
+func (m *Memory) Put(key string, e Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		el.Value.(*memoryItem).entry = e
+		m.order.MoveToFront(el)
+		return nil
+	}
+	m.entries[key] = m.order.PushFront(&memoryItem{key: key, entry: e})
+	for m.max > 0 && m.order.Len() > m.max {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryItem).key)
+	}
+	return nil
+}
+
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		m.order.Remove(el)
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+func (m *Memory) DeleteWhere(match func(Entry) bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for key, el := range m.entries {
+		if match(el.Value.(*memoryItem).entry) {
+			m.order.Remove(el)
+			delete(m.entries, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+func (m *Memory) Close() error { return nil }
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// ProviderError envuelve una falla de un proveedor de inferencia con la
+// información necesaria para decidir si vale la pena reintentar.
+type ProviderError struct {
+	Provider   string
+	StatusCode int           // código HTTP, 0 si el transporte no es HTTP
+	Retryable  bool          // 429, 5xx, cuota agotada, nodo no disponible
+	RetryAfter time.Duration // pista del servidor (header Retry-After), 0 si no viene
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s: HTTP %d: %v", e.Provider, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Provider, e.Err)
+}
+
+func (e *ProviderError) Unwrap() error { return e.Err }
+
+// IsRetryable clasifica un error como transitorio (reintentable) o fatal.
+// Los errores de red y los ProviderError marcados como Retryable son
+// transitorios; una cancelación explícita del llamador nunca lo es.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe.Retryable
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// RetryAfter retorna la espera sugerida por el proveedor, si la hay.
+func RetryAfter(err error) time.Duration {
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe.RetryAfter
+	}
+	return 0
+}
+
+// ErrInvalidOutput indica que el proveedor respondió, pero su salida no
+// contiene un prompt utilizable. No es transitorio ni una falla de salud:
+// el proveedor está disponible.
+var ErrInvalidOutput = errors.New("salida del modelo inválida")
+
+// ErrRepairUnsupported indica que el proveedor no implementa Repairer.
+var ErrRepairUnsupported = errors.New("el proveedor no soporta reparación")
@@ -2,8 +2,57 @@ package core
 
 import "context"
 
+// Instruction es el meta-prompt de optimización ya renderizado para un prompt
+// concreto. El SDK lo construye una sola vez y todos los proveedores lo envían
+// tal cual, para que el resultado no dependa de qué backend respondió.
+type Instruction struct {
+	Version string // versión de la plantilla usada, registrada en el audit log
+	System  string // reglas del compilador (system prompt)
+	User    string // borrador y hallazgos a corregir
+}
+
 // Optimizer define el contrato para cualquier IA que quiera mejorar un prompt.
+// La respuesta se pide como JSON (role, context, task, constraints) y vuelve
+// como core.Prompt, para que el SDK pueda re-analizarla y compilarla.
 type Optimizer interface {
 	Name() string
-	Optimize(ctx context.Context, p Prompt, issues []string) (string, error)
+	Optimize(ctx context.Context, inst Instruction) (Optimization, error)
+}
+
+// ModelNamer lo implementan los proveedores que saben qué modelo usarán
+// antes de llamar. La caché de respuestas lo incluye en la clave.
+type ModelNamer interface {
+	ModelName() string
+}
+
+// ChunkHandler recibe cada fragmento de texto a medida que el proveedor lo genera.
+type ChunkHandler func(chunk string)
+
+// StreamOptimizer es un Optimizer capaz de entregar su salida por fragmentos.
+// La Optimization retornada es siempre la respuesta completa, igual que en
+// Optimize, para que el SDK pueda auditarla sin reconstruirla desde los chunks.
+type StreamOptimizer interface {
+	Optimizer
+	OptimizeStream(ctx context.Context, inst Instruction, onChunk ChunkHandler) (Optimization, error)
+}
+
+// RepairRequest es un prompt que no pasó el linter, con sus hallazgos.
+type RepairRequest struct {
+	Prompt      Prompt
+	Issues      []string
+	Suggestions []string
+}
+
+// Repair es la corrección propuesta por un proveedor. Prompt conserva id,
+// version y variables del original; quien la aplica decide cómo escribirla.
+type Repair struct {
+	Prompt     Prompt
+	Provenance Provenance
+}
+
+// Repairer es la segunda capacidad de un proveedor: reescribir un prompt a
+// partir de los hallazgos del linter. La implementan todos los backends,
+// incluido el nodo local.
+type Repairer interface {
+	Repair(ctx context.Context, req RepairRequest) (Repair, error)
 }
@@ -23,3 +23,23 @@ type Result struct {
 	Issues      []string `json:"issues"`
 	Suggestions []string `json:"suggestions"`
 }
+
+// Provenance registra qué proveedor y modelo produjeron una optimización y
+// cuánto costó. Los tokens son los que reporta el backend; si no los reporta
+// se estiman como caracteres / 4.
+type Provenance struct {
+	Provider     string `json:"provider"`
+	Model        string `json:"model"`
+	LatencyMs    int64  `json:"latency_ms"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+	Instruction  string `json:"instruction"` // versión del meta-prompt usado
+}
+
+// Optimization es la salida estructurada de un Optimizer: el prompt
+// reescrito, listo para que el engine lo compile de forma determinista.
+type Optimization struct {
+	Prompt     Prompt     `json:"prompt"`
+	Raw        string     `json:"raw"` // texto tal cual lo devolvió el modelo
+	Provenance Provenance `json:"provenance"`
+}
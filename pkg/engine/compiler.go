@@ -9,11 +9,14 @@ import (
 
 type CompilerEngine struct {
 	MinScoreThreshold int
+	// ExpectedLanguage es el idioma que Validate exige a la salida optimizada ("es", "en").
+	ExpectedLanguage string
 }
 
 func New() *CompilerEngine {
 	return &CompilerEngine{
 		MinScoreThreshold: 85,
+		ExpectedLanguage:  "es",
 	}
 }
 
@@ -78,6 +81,29 @@ func (e *CompilerEngine) ResolveVariables(content string, p core.Prompt) string
 	return result
 }
 
+// Placeholders retorna los nombres de los {{placeholders}} de content, sin
+// repetir y en orden de aparición.
+func Placeholders(content string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for {
+		start := strings.Index(content, "{{")
+		if start == -1 {
+			return names
+		}
+		end := strings.Index(content[start:], "}}")
+		if end == -1 {
+			return names
+		}
+		name := strings.TrimSpace(content[start+2 : start+end])
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		content = content[start+end+2:]
+	}
+}
+
 // Compile construye el prompt final resolviendo variables antes de
 // armar la estructura por secciones. El Task puede contener un template
 // completo con placeholders — ResolveVariables lo resuelve primero.
@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+)
+
+// Verdict es el resultado de validar el prompt propuesto por un optimizador
+// contra el prompt original.
+type Verdict struct {
+	Accepted      bool
+	OriginalScore int
+	Score         int
+	Reasons       []string
+	Parsed        core.Prompt
+}
+
+// sectionAliases mapea los headers que usan tanto la instrucción de
+// optimización (inglés) como los templates industriales (español).
+var sectionAliases = map[string]string{
+	"ROLE":          "role",
+	"ROL":           "role",
+	"CONTEXT":       "context",
+	"CONTEXTO":      "context",
+	"TASK":          "task",
+	"TAREA":         "task",
+	"CONSTRAINTS":   "constraints",
+	"RESTRICCIONES": "constraints",
+	"VARIABLES":     "variables",
+}
+
+// ParseSections reconstruye un core.Prompt desde un texto con headers
+// Markdown (### ROLE, ### CONTEXT, ...). Las secciones desconocidas se
+// anexan al Task con su header, porque en los templates son parte de la
+// tarea (ej: ### PROTOCOLO DE ANÁLISIS OBLIGATORIO). También retorna las
+// secciones encontradas, en orden; "preamble" indica texto antes del primer header.
+func ParseSections(text string) (core.Prompt, []string) {
+	var p core.Prompt
+	var found []string
+	sections := map[string]*strings.Builder{}
+	current := ""
+	var preamble strings.Builder
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "#") {
+			header := strings.ToUpper(strings.TrimSpace(strings.TrimLeft(trimmed, "#")))
+			if key, ok := matchSection(header); ok {
+				current = key
+				found = append(found, key)
+				if sections[key] == nil {
+					sections[key] = &strings.Builder{}
+				}
+				continue
+			}
+			if current != "" && current != "task" {
+				current = "task"
+				if sections["task"] == nil {
+					sections["task"] = &strings.Builder{}
+				}
+			}
+		}
+		if current == "" {
+			preamble.WriteString(line + "\n")
+			continue
+		}
+		sections[current].WriteString(line + "\n")
+	}
+
+	get := func(key string) string {
+		if b := sections[key]; b != nil {
+			return strings.TrimSpace(b.String())
+		}
+		return ""
+	}
+	p.Role = get("role")
+	p.Context = get("context")
+	p.Task = get("task")
+	for _, line := range strings.Split(get("constraints"), "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*•"))
+		if line != "" {
+			p.Constraints = append(p.Constraints, line)
+		}
+	}
+	if strings.TrimSpace(preamble.String()) != "" {
+		found = append([]string{"preamble"}, found...)
+	}
+	return p, found
+}
+
+// matchSection acepta headers exactos o con sufijo ("CONTEXTO DE NEGOCIO").
+func matchSection(header string) (string, bool) {
+	words := strings.Fields(header)
+	if len(words) == 0 {
+		return "", false
+	}
+	key, ok := sectionAliases[words[0]]
+	return key, ok
+}
+
+// Validate decide si el prompt que propone un optimizador puede reemplazar
+// al original: debe tener tarea y restricciones, conservar las restricciones
+// y variables originales, estar en el idioma esperado y no puntuar peor que
+// la entrada.
+func (e *CompilerEngine) Validate(original, candidate core.Prompt) Verdict {
+	before := e.Analyze(original)
+	v := Verdict{OriginalScore: before.Score, Parsed: candidate}
+
+	if len(candidate.Constraints) == 0 {
+		v.Reasons = append(v.Reasons, "faltan las restricciones (constraints)")
+	}
+	if strings.TrimSpace(candidate.Task) == "" {
+		v.Reasons = append(v.Reasons, "falta la tarea (task)")
+	}
+
+	// Se valida el texto que efectivamente se compilaría, sin la sección de
+	// variables: sus valores tienen que aparecer en el contenido del prompt.
+	body := candidate
+	body.Variables = nil
+	output, _ := e.Compile(body)
+
+	normOut := normalize(output)
+	for _, c := range original.Constraints {
+		if strings.TrimSpace(c) != "" && !constraintSurvived(c, normOut) {
+			v.Reasons = append(v.Reasons, fmt.Sprintf("restricción original perdida: %q", c))
+		}
+	}
+	for k, val := range original.Variables {
+		if strings.TrimSpace(val) != "" && !strings.Contains(normOut, normalize(val)) {
+			v.Reasons = append(v.Reasons, fmt.Sprintf("variable %s perdida", k))
+		}
+	}
+	for _, marker := range missingMarkers(e.ResolveVariables(original.Task, original)) {
+		if !strings.Contains(output, marker) {
+			v.Reasons = append(v.Reasons, fmt.Sprintf("marcador %s eliminado", marker))
+		}
+	}
+
+	if lang := e.ExpectedLanguage; lang != "" && detectLanguage(output) != lang {
+		v.Reasons = append(v.Reasons, fmt.Sprintf("idioma distinto al esperado (%s)", lang))
+	}
+
+	// Re-score: el Task del resultado es texto final, sin placeholders
+	scored := candidate
+	scored.Variables = original.Variables
+	after := e.Analyze(scored)
+	v.Score = after.Score
+	if after.Score < before.Score {
+		v.Reasons = append(v.Reasons, fmt.Sprintf("score empeoró: %d -> %d", before.Score, after.Score))
+	}
+
+	v.Accepted = len(v.Reasons) == 0
+	return v
+}
+
+// constraintSurvived tolera reformulaciones: basta con que la restricción
+// aparezca literal o que el 70% de sus palabras significativas sigan presentes.
+func constraintSurvived(constraint, normOut string) bool {
+	norm := normalize(constraint)
+	if strings.Contains(normOut, norm) {
+		return true
+	}
+	var words, kept int
+	for _, w := range strings.Fields(norm) {
+		if len([]rune(w)) <= 3 {
+			continue
+		}
+		words++
+		if strings.Contains(normOut, w) {
+			kept++
+		}
+	}
+	return words > 0 && kept*10 >= words*7
+}
+
+func missingMarkers(text string) []string {
+	var out []string
+	for {
+		start := strings.Index(text, "[MISSING:")
+		if start == -1 {
+			return out
+		}
+		end := strings.Index(text[start:], "]")
+		if end == -1 {
+			return out
+		}
+		out = append(out, text[start:start+end+1])
+		text = text[start+end+1:]
+	}
+}
+
+// normalize baja a minúsculas y colapsa puntuación para comparar textos.
+func normalize(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+var (
+	spanishStopwords = map[string]bool{"de": true, "la": true, "el": true, "que": true, "en": true, "los": true, "las": true, "para": true, "con": true, "por": true, "una": true, "del": true, "se": true, "es": true, "su": true, "al": true}
+	englishStopwords = map[string]bool{"the": true, "and": true, "of": true, "to": true, "is": true, "for": true, "with": true, "that": true, "you": true, "your": true, "this": true, "are": true, "be": true, "on": true, "as": true}
+)
+
+// detectLanguage distingue español de inglés contando palabras funcionales.
+func detectLanguage(text string) string {
+	var es, en int
+	for _, w := range strings.Fields(normalize(text)) {
+		if spanishStopwords[w] {
+			es++
+		}
+		if englishStopwords[w] {
+			en++
+		}
+	}
+	if en > es {
+		return "en"
+	}
+	return "es"
+}
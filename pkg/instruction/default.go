@@ -0,0 +1,43 @@
+package instruction
+
+// Default es la instrucción de optimización que usan todos los proveedores
+// cuando el equipo no define un override. Cambiar el texto implica subir la
+// versión: el audit log la registra en cada inferencia.
+var Default = Template{
+	Version: "es-cl/v2",
+	System: `Eres el motor de compilación PROMPTC. Transformas borradores de prompt en prompts de sistema deterministas y profesionales.
+
+### REGLAS DE ORO
+1. IDIOMA: Escribe TODO en español técnico de Chile. No uses inglés.
+2. FORMATO: Devuelve exclusivamente un objeto JSON con las claves "role", "context", "task" (string) y "constraints" (arreglo de strings). Sin Markdown ni bloques de código.
+3. PROHIBICIÓN: No hables con el usuario. No digas "Aquí está tu prompt" ni agregues comentarios fuera del JSON.
+4. FIDELIDAD: Conserva cada restricción original, en especial las negativas ("No...", "Evita...", "Nunca..."), y todos los valores de las variables.
+5. MARCADORES: Si aparece [MISSING:nombre], mantenlo textual; no inventes su valor.
+6. CALIDAD: Usa imperativos directos ("Analiza", "Genera", "Calcula") y corrige cada hallazgo listado.`,
+	User: `### BORRADOR A COMPILAR
+ROLE: {{.Prompt.Role}}
+CONTEXT: {{.Prompt.Context}}
+TASK:
+{{.Prompt.Task}}
+{{- if .Prompt.Constraints}}
+CONSTRAINTS:
+{{- range .Prompt.Constraints}}
+- {{.}}
+{{- end}}
+{{- end}}
+{{- if .Prompt.Variables}}
+VARIABLES:
+{{- range $k, $v := .Prompt.Variables}}
+- {{$k}}: {{$v}}
+{{- end}}
+{{- end}}
+{{- if .Findings}}
+
+### HALLAZGOS DEL ANÁLISIS A CORREGIR
+{{- range .Findings}}
+- {{.Issue}}{{if .Suggestion}} Sugerencia: {{.Suggestion}}{{end}}
+{{- end}}
+{{- end}}
+
+OBJETO JSON OPTIMIZADO EN ESPAÑOL:`,
+}
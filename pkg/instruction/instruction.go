@@ -0,0 +1,149 @@
+package instruction
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+	"gopkg.in/yaml.v3"
+)
+
+// Template es una versión del meta-prompt de optimización. System y User
+// son plantillas text/template que reciben un Data.
+type Template struct {
+	Version string `yaml:"version"`
+	System  string `yaml:"system"`
+	User    string `yaml:"user"`
+}
+
+// Finding es un hallazgo del análisis estático con su sugerencia de corrección.
+type Finding struct {
+	Issue      string
+	Suggestion string
+}
+
+// Data es lo que ven las plantillas al renderizar.
+type Data struct {
+	Prompt   core.Prompt
+	Findings []Finding
+}
+
+// FindingsFrom empareja Issues y Suggestions de un core.Result.
+func FindingsFrom(r core.Result) []Finding {
+	findings := make([]Finding, 0, len(r.Issues))
+	for i, issue := range r.Issues {
+		f := Finding{Issue: issue}
+		if i < len(r.Suggestions) {
+			f.Suggestion = r.Suggestions[i]
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// Render produce la instrucción final para un prompt y sus hallazgos.
+func (t Template) Render(p core.Prompt, findings []Finding) (core.Instruction, error) {
+	data := Data{Prompt: p, Findings: findings}
+	system, err := execute(t.Version+"/system", t.System, data)
+	if err != nil {
+		return core.Instruction{}, err
+	}
+	user, err := execute(t.Version+"/user", t.User, data)
+	if err != nil {
+		return core.Instruction{}, err
+	}
+	return core.Instruction{Version: t.Version, System: system, User: user}, nil
+}
+
+// Validate compila ambas plantillas sin ejecutarlas.
+func (t Template) Validate() error {
+	if strings.TrimSpace(t.Version) == "" {
+		return fmt.Errorf("instrucción sin version")
+	}
+	if _, err := template.New("system").Parse(t.System); err != nil {
+		return fmt.Errorf("instrucción %s: system: %w", t.Version, err)
+	}
+	if _, err := template.New("user").Parse(t.User); err != nil {
+		return fmt.Errorf("instrucción %s: user: %w", t.Version, err)
+	}
+	return nil
+}
+
+func execute(name, text string, data Data) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("instrucción %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("instrucción %s: %w", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Registry resuelve qué versión de la instrucción usa cada equipo.
+// Los equipos sin override usan la instrucción por defecto.
+type Registry struct {
+	mu       sync.RWMutex
+	fallback Template
+	teams    map[string]Template
+}
+
+func NewRegistry() *Registry {
+	return &Registry{fallback: Default, teams: make(map[string]Template)}
+}
+
+// For retorna la plantilla del equipo, o la por defecto si no tiene override.
+func (r *Registry) For(team string) Template {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if t, ok := r.teams[team]; ok && team != "" {
+		return t
+	}
+	return r.fallback
+}
+
+// Set registra el override de un equipo. El equipo "default" reemplaza la
+// instrucción por defecto para todos.
+func (r *Registry) Set(team string, t Template) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if team == "default" {
+		r.fallback = t
+		return nil
+	}
+	r.teams[team] = t
+	return nil
+}
+
+// LoadDir carga un override por archivo: <dir>/<equipo>.yaml. Un directorio
+// inexistente no es error — simplemente no hay overrides.
+func (r *Registry) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("no se pudo leer %s: %w", path, err)
+		}
+		var t Template
+		if err := yaml.Unmarshal(data, &t); err != nil {
+			return fmt.Errorf("error de sintaxis en %s: %w", path, err)
+		}
+		team := strings.TrimSuffix(filepath.Base(path), ".yaml")
+		if err := r.Set(team, t); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// --- CLIENTE EN MEMORIA ---
+// Client conecta con un Server por un par de io.Pipe, sin red ni procesos:
+// recorre el mismo camino que un cliente stdio (Serve, sesión, handshake,
+// despacho concurrente), así que sirve para probar el servidor completo
+// desde Go y para embeber PROMPTC en otro proceso.
+
+// ErrClientClosed se retorna en las llamadas pendientes cuando el cliente
+// se cierra o el servidor deja de responder.
+var ErrClientClosed = errors.New("mcp: cliente cerrado")
+
+// Client es un cliente MCP conectado en memoria a un Server. Es seguro para
+// uso concurrente.
+type Client struct {
+	toServer *io.PipeWriter
+
+	writeMu sync.Mutex
+	nextID  atomic.Int64
+
+	mu      sync.Mutex
+	pending map[string]chan clientMessage
+	closed  bool
+
+	notifications chan Message
+	served        chan error // resultado de Serve
+	readDone      chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// clientMessage es cualquier mensaje que llega del servidor: respuesta
+// (con ID) o notificación (con Method).
+type clientMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// notificationBuffer es cuántas notificaciones del servidor se retienen sin
+// leer; las que excedan se descartan para no bloquear al servidor.
+const notificationBuffer = 64
+
+// NewClient conecta un cliente nuevo a s. Cada Client es una sesión
+// independiente; hay que llamar a Initialize antes de usar herramientas.
+func NewClient(s *Server) *Client {
+	serverIn, toServer := io.Pipe()
+	clientIn, fromServer := io.Pipe()
+	c := &Client{
+		toServer:      toServer,
+		pending:       map[string]chan clientMessage{},
+		notifications: make(chan Message, notificationBuffer),
+		served:        make(chan error, 1),
+		readDone:      make(chan struct{}),
+	}
+	go func() {
+		err := s.Serve(serverIn, fromServer)
+		fromServer.Close()
+		c.served <- err
+	}()
+	go c.readLoop(clientIn)
+	return c
+}
+
+func (c *Client) readLoop(r io.Reader) {
+	defer close(c.readDone)
+	defer close(c.notifications)
+	defer c.failPending()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg clientMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.Method != "" {
+			select {
+			case c.notifications <- Message{JSONRPC: "2.0", Method: msg.Method, Params: msg.Params}:
+			default:
+			}
+			continue
+		}
+		key := string(msg.ID)
+		c.mu.Lock()
+		ch, ok := c.pending[key]
+		delete(c.pending, key)
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+}
+
+// failPending despierta a las llamadas que ya no recibirán respuesta.
+func (c *Client) failPending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for key, ch := range c.pending {
+		close(ch)
+		delete(c.pending, key)
+	}
+}
+
+func (c *Client) send(v interface{}) error {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.toServer, "%s\n", out); err != nil {
+		return ErrClientClosed
+	}
+	return nil
+}
+
+// Call envía una solicitud y decodifica su result en result (puede ser
+// nil). Un error JSON-RPC se retorna como *Error. Si ctx termina antes de
+// la respuesta, se envía notifications/cancelled y se retorna ctx.Err().
+func (c *Client) Call(ctx context.Context, method string, params, result interface{}) error {
+	id := c.nextID.Add(1)
+	key := fmt.Sprintf("%d", id)
+	ch := make(chan clientMessage, 1)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClientClosed
+	}
+	c.pending[key] = ch
+	c.mu.Unlock()
+
+	if err := c.send(struct {
+		JSONRPC string      `json:"jsonrpc"`
+		ID      int64       `json:"id"`
+		Method  string      `json:"method"`
+		Params  interface{} `json:"params,omitempty"`
+	}{"2.0", id, method, params}); err != nil {
+		c.mu.Lock()
+		delete(c.pending, key)
+		c.mu.Unlock()
+		return err
+	}
+
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return ErrClientClosed
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil || len(msg.Result) == 0 {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, key)
+		c.mu.Unlock()
+		c.Notify("notifications/cancelled", map[string]interface{}{
+			"requestId": id,
+			"reason":    ctx.Err().Error(),
+		})
+		return ctx.Err()
+	}
+}
+
+// Notify envía una notificación; el servidor no responde.
+func (c *Client) Notify(method string, params interface{}) error {
+	return c.send(Notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// Notifications entrega las notificaciones del servidor (progress,
+// list_changed, resources/updated). Se cierra con el cliente.
+func (c *Client) Notifications() <-chan Message {
+	return c.notifications
+}
+
+// InitializeResult es la respuesta de initialize.
+type InitializeResult struct {
+	ProtocolVersion string                     `json:"protocolVersion"`
+	ServerInfo      ClientInfo                 `json:"serverInfo"`
+	Capabilities    map[string]json.RawMessage `json:"capabilities"`
+}
+
+// Initialize hace el handshake completo: initialize con la revisión pedida
+// (vacía: la más nueva que soporta el servidor) y notifications/initialized.
+func (c *Client) Initialize(ctx context.Context, protocolVersion string, info ClientInfo) (*InitializeResult, error) {
+	if protocolVersion == "" {
+		protocolVersion = latestProtocol
+	}
+	var result InitializeResult
+	err := c.Call(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": protocolVersion,
+		"clientInfo":      info,
+		"capabilities":    map[string]interface{}{},
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Notify("notifications/initialized", nil); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Tool es una herramienta tal como la publica tools/list.
+type Tool struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description"`
+	InputSchema  map[string]interface{} `json:"inputSchema"`
+	OutputSchema map[string]interface{} `json:"outputSchema,omitempty"`
+}
+
+// ListTools retorna las herramientas del servidor.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var result struct {
+		Tools []Tool `json:"tools"`
+	}
+	if err := c.Call(ctx, "tools/list", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Tools, nil
+}
+
+// Content es un bloque de contenido de un resultado de herramienta.
+type Content struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+// ToolResult es el resultado de tools/call. Una herramienta que falló
+// responde IsError con el mensaje en Content, no un error JSON-RPC.
+type ToolResult struct {
+	Content           []Content       `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+	IsError           bool            `json:"isError,omitempty"`
+}
+
+// Text concatena los bloques de texto del resultado.
+func (r *ToolResult) Text() string {
+	var parts []string
+	for _, c := range r.Content {
+		if c.Type == "text" {
+			parts = append(parts, c.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// CallTool invoca una herramienta. args se serializa como arguments.
+func (c *Client) CallTool(ctx context.Context, name string, args interface{}) (*ToolResult, error) {
+	var result ToolResult
+	err := c.Call(ctx, "tools/call", map[string]interface{}{
+		"name":      name,
+		"arguments": args,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close cierra la sesión: el servidor termina las solicitudes en curso,
+// Serve retorna y las llamadas pendientes fallan con ErrClientClosed.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		c.toServer.Close()
+		c.closeErr = <-c.served
+		<-c.readDone
+	})
+	return c.closeErr
+}
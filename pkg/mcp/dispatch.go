@@ -0,0 +1,135 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// --- DESPACHO CONCURRENTE MCP ---
+// Cada tools/call corre en su propia goroutine con su propio context; el
+// cliente puede cancelarla con notifications/cancelled.
+
+// toolTimeout es el plazo de cada herramienta según su toolSpec.
+// optimize_prompt incluye la espera en la cola del pool de inferencia y se
+// puede ajustar con Config.OptimizeTimeout.
+const defaultToolTimeout = 30 * time.Second
+
+func (s *Server) toolTimeout(name string) time.Duration {
+	if name == "optimize_prompt" && s.optimizeTimeout > 0 {
+		return s.optimizeTimeout
+	}
+	if tool, ok := s.tools.lookup(name); ok && tool.Timeout > 0 {
+		return tool.Timeout
+	}
+	return defaultToolTimeout
+}
+
+// inflightRequest es una solicitud en curso que el cliente puede cancelar.
+type inflightRequest struct {
+	cancel    context.CancelFunc
+	cancelled bool // cancelada por notifications/cancelled: no se responde
+}
+
+// requestRegistry indexa las solicitudes en curso de una sesión por su ID
+// JSON-RPC: dos clientes HTTP pueden usar el mismo ID sin pisarse.
+type requestRegistry struct {
+	sync.Mutex
+	requests map[string]*inflightRequest
+	wg       sync.WaitGroup
+}
+
+func newRequestRegistry() *requestRegistry {
+	return &requestRegistry{requests: make(map[string]*inflightRequest)}
+}
+
+// requestKey normaliza el ID: JSON-RPC permite números o strings.
+func requestKey(id interface{}) string {
+	return fmt.Sprintf("%v", id)
+}
+
+// dispatch ejecuta handler en una goroutine con un context cancelable
+// asociado a req.ID.
+func (r *requestRegistry) dispatch(id interface{}, handler func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	key := requestKey(id)
+	r.Lock()
+	r.requests[key] = &inflightRequest{cancel: cancel}
+	r.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer func() {
+			r.Lock()
+			delete(r.requests, key)
+			r.Unlock()
+			cancel()
+		}()
+		handler(ctx)
+	}()
+}
+
+// cancel atiende notifications/cancelled. Retorna false si la solicitud ya
+// terminó o nunca existió, lo que el protocolo permite.
+func (r *requestRegistry) cancel(id interface{}) bool {
+	r.Lock()
+	defer r.Unlock()
+	req, ok := r.requests[requestKey(id)]
+	if !ok {
+		return false
+	}
+	req.cancelled = true
+	req.cancel()
+	return true
+}
+
+// wasCancelled indica si el cliente canceló la solicitud; su respuesta se descarta.
+func (r *requestRegistry) wasCancelled(id interface{}) bool {
+	r.Lock()
+	defer r.Unlock()
+	req, ok := r.requests[requestKey(id)]
+	return ok && req.cancelled
+}
+
+// cancelAll cancela todo lo que sigue en curso (cierre de la sesión).
+func (r *requestRegistry) cancelAll() {
+	r.Lock()
+	defer r.Unlock()
+	for _, req := range r.requests {
+		req.cancelled = true
+		req.cancel()
+	}
+}
+
+// wait bloquea hasta que terminen las solicitudes en curso (cierre de stdin).
+func (r *requestRegistry) wait() {
+	r.wg.Wait()
+}
+
+// handleCancelled procesa notifications/cancelled del cliente MCP.
+func (s *Server) handleCancelled(req *request) {
+	var params struct {
+		RequestID interface{} `json:"requestId"`
+		Reason    string      `json:"reason"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.RequestID == nil {
+		return
+	}
+	result := "OK"
+	detail := params.Reason
+	if !req.session.inflight.cancel(params.RequestID) {
+		result = "WARN"
+		detail = "la solicitud ya había terminado"
+	}
+	s.audit(AuditEvent{
+		Type:     "MCP",
+		Action:   "REQUEST_CANCELLED",
+		Actor:    req.session.Client(),
+		Resource: requestKey(params.RequestID),
+		Result:   result,
+		Detail:   detail,
+	})
+}
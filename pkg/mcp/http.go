@@ -0,0 +1,312 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// --- MCP STREAMABLE HTTP ---
+// Handler montado en /mcp del dashboard permite que varios clientes del equipo usen
+// un mismo PROMPTC frente al Mac mini. Cada mensaje llega por POST; la
+// respuesta vuelve como JSON o, para tools/call de clientes que aceptan
+// text/event-stream, como SSE con el progreso antes del resultado. GET abre
+// el stream de notificaciones del servidor (list_changed, resources/updated)
+// y DELETE cierra la sesión. Los handlers son los mismos del loop stdio.
+
+const (
+	sessionHeader  = "Mcp-Session-Id"
+	protocolHeader = "Mcp-Protocol-Version"
+
+	// sessionIdleTimeout descarta sesiones HTTP abandonadas sin DELETE.
+	sessionIdleTimeout = 30 * time.Minute
+	// streamKeepAlive evita que proxies corten un stream GET inactivo.
+	streamKeepAlive = 25 * time.Second
+	maxMessageBytes = 1024 * 1024
+)
+
+// Handler retorna el transporte Streamable HTTP del servidor. La primera
+// llamada arranca el barrido de sesiones abandonadas.
+func (s *Server) Handler() http.Handler {
+	s.janitor.Do(s.startSessionJanitor)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowedOrigin(r) {
+			http.Error(w, "origen no permitido", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPost:
+			s.httpPost(w, r)
+		case http.MethodGet:
+			s.httpNotificationStream(w, r)
+		case http.MethodDelete:
+			s.httpDeleteSession(w, r)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "método no permitido", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// allowedOrigin protege contra DNS rebinding: un navegador solo puede
+// llamar a /mcp desde el mismo host o desde localhost. Los clientes MCP
+// nativos no envían Origin.
+func allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return u.Host == r.Host
+}
+
+// requestSession resuelve el Mcp-Session-Id o responde 400/404. Desde
+// 2025-06-18 el cliente repite la revisión negociada en cada solicitud: si
+// envía el header, debe coincidir con la de su sesión.
+func (s *Server) requestSession(w http.ResponseWriter, r *http.Request) (*session, bool) {
+	id := r.Header.Get(sessionHeader)
+	if id == "" {
+		http.Error(w, "falta el header "+sessionHeader, http.StatusBadRequest)
+		return nil, false
+	}
+	sess, ok := s.lookupSession(id)
+	if !ok || sess.Transport != "http" {
+		http.Error(w, "sesión MCP desconocida o expirada", http.StatusNotFound)
+		return nil, false
+	}
+	if v := r.Header.Get(protocolHeader); v != "" && v != sess.Protocol() {
+		http.Error(w, fmt.Sprintf("revisión MCP %s distinta de la negociada en la sesión (%s)", v, sess.Protocol()), http.StatusBadRequest)
+		return nil, false
+	}
+	return sess, true
+}
+
+func writeJSONRPC(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeSSE(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+func (s *Server) httpPost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageBytes))
+	if err != nil {
+		writeJSONRPC(w, http.StatusBadRequest, errorResponse(nil, CodeParseError, "cuerpo ilegible", err.Error()))
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		writeJSONRPC(w, http.StatusBadRequest, errorResponse(nil, CodeInvalidRequest, "batch JSON-RPC no soportado", nil))
+		return
+	}
+	var msg Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		writeJSONRPC(w, http.StatusBadRequest, errorResponse(nil, CodeParseError, "JSON inválido", err.Error()))
+		return
+	}
+
+	var sess *session
+	if msg.Method == "initialize" {
+		id := newSessionID()
+		sess = s.registerSession(newSession(id, "http", "mcp-http/"+id[:8], nil))
+		w.Header().Set(sessionHeader, id)
+		s.audit(AuditEvent{
+			Type:     "MCP",
+			Action:   "SESSION_OPENED",
+			Actor:    sess.Client(),
+			Resource: id,
+			Result:   "OK",
+			Detail:   fmt.Sprintf("Streamable HTTP desde %s", r.RemoteAddr),
+		})
+	} else {
+		var ok bool
+		if sess, ok = s.requestSession(w, r); !ok {
+			return
+		}
+	}
+
+	// Notificaciones y respuestas del cliente: se procesan y se acusa recibo
+	if msg.ID == nil {
+		s.handleMessage(&request{Message: msg, session: sess, write: func(interface{}) {}})
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	msgs := make(chan interface{}, 16)
+	gone := make(chan struct{})
+	defer close(gone)
+	req := &request{Message: msg, session: sess, done: make(chan struct{})}
+	req.write = func(v interface{}) {
+		select {
+		case msgs <- v:
+		case <-gone:
+		}
+	}
+
+	stream := msg.Method == "tools/call" && acceptsEventStream(r)
+	if stream {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+
+	// emit retorna true cuando v es la respuesta: ahí termina el POST
+	emit := func(v interface{}) bool {
+		resp, isResponse := v.(Response)
+		switch {
+		case stream:
+			writeSSE(w, v)
+		case isResponse:
+			writeJSONRPC(w, http.StatusOK, resp)
+		}
+		return isResponse
+	}
+
+	s.handleMessage(req)
+	for {
+		select {
+		case v := <-msgs:
+			if emit(v) {
+				return
+			}
+		case <-req.done:
+			// La respuesta ya está en el canal, o se descartó por cancelación
+			for {
+				select {
+				case v := <-msgs:
+					if emit(v) {
+						return
+					}
+				default:
+					if !stream {
+						w.WriteHeader(http.StatusNoContent)
+					}
+					return
+				}
+			}
+		case <-r.Context().Done():
+			// El cliente cortó la conexión: nadie leerá el resultado
+			sess.inflight.cancel(msg.ID)
+			return
+		}
+	}
+}
+
+// mcpNotificationStream atiende GET: un stream SSE por sesión para las
+// notificaciones que el servidor inicia.
+func (s *Server) httpNotificationStream(w http.ResponseWriter, r *http.Request) {
+	if !acceptsEventStream(r) {
+		http.Error(w, "GET /mcp requiere Accept: text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	sess, ok := s.requestSession(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := w.(http.Flusher); !ok {
+		http.Error(w, "streaming no soportado", http.StatusInternalServerError)
+		return
+	}
+
+	msgs := make(chan interface{}, 64)
+	stop := sess.attachStream(func(v interface{}) {
+		select {
+		case msgs <- v:
+		default:
+			// Cliente lento: se pierde la notificación, no el servidor
+		}
+	})
+	defer sess.detachStream(stop)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case v := <-msgs:
+			writeSSE(w, v)
+		case <-keepAlive.C:
+			sess.touch()
+			fmt.Fprint(w, ": ping\n\n")
+			w.(http.Flusher).Flush()
+		case <-stop:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) httpDeleteSession(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.requestSession(w, r)
+	if !ok {
+		return
+	}
+	s.closeSession(sess.ID)
+	s.audit(AuditEvent{
+		Type:     "MCP",
+		Action:   "SESSION_CLOSED",
+		Actor:    sess.Client(),
+		Resource: sess.ID,
+		Result:   "OK",
+		Detail:   "Sesión terminada por el cliente",
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startSessionJanitor cierra las sesiones HTTP sin actividad ni stream
+// abierto durante sessionIdleTimeout.
+func (s *Server) startSessionJanitor() {
+	go func() {
+		for range time.Tick(time.Minute) {
+			cutoff := time.Now().Add(-sessionIdleTimeout).UnixNano()
+			for _, sess := range s.allSessions() {
+				if sess.Transport != "http" || sess.streaming() || sess.lastSeen.Load() > cutoff {
+					continue
+				}
+				s.closeSession(sess.ID)
+				s.audit(AuditEvent{
+					Type:     "MCP",
+					Action:   "SESSION_EXPIRED",
+					Actor:    sess.Client(),
+					Resource: sess.ID,
+					Result:   "WARN",
+					Detail:   fmt.Sprintf("Sin actividad por %s", sessionIdleTimeout),
+				})
+			}
+		}
+	}()
+}
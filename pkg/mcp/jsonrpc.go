@@ -0,0 +1,61 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// --- TIPOS JSON-RPC ---
+
+// Message es un mensaje JSON-RPC 2.0 entrante: solicitud (con ID) o
+// notificación (sin ID).
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      interface{}     `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response es la respuesta a una solicitud: Result o Error, nunca ambos.
+type Response struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      interface{} `json:"id"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   *Error      `json:"error,omitempty"`
+}
+
+// Error es el objeto de error de JSON-RPC 2.0. Se usa para fallas del
+// protocolo; las fallas de una herramienta van como resultado con isError.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc %d: %s", e.Code, e.Message)
+}
+
+// Códigos de error estándar de JSON-RPC 2.0, más el que MCP define para un
+// recurso inexistente.
+const (
+	CodeParseError       = -32700
+	CodeInvalidRequest   = -32600
+	CodeMethodNotFound   = -32601
+	CodeInvalidParams    = -32602
+	CodeInternalError    = -32603
+	CodeResourceNotFound = -32002
+)
+
+// Notification es un mensaje sin ID: quien lo recibe no responde.
+type Notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// errorResponse arma un error JSON-RPC. id es nil cuando no se pudo leer el
+// ID de la solicitud (parse error), y se serializa como null.
+func errorResponse(id interface{}, code int, message string, data interface{}) Response {
+	return Response{JSONRPC: "2.0", ID: id, Error: &Error{Code: code, Message: message, Data: data}}
+}
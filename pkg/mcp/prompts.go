@@ -0,0 +1,147 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+	"github.com/andesdevroot/promptc/pkg/engine"
+)
+
+// --- MCP PROMPTS ---
+// Cada template de templates.json se publica como prompt MCP. Sus argumentos
+// son los {{placeholders}} del contenido, así el cliente los pide en su UI
+// en vez de depender de get_template.
+
+// optionalPromptArgs son placeholders que ResolveVariables acepta vacíos.
+var optionalPromptArgs = map[string]bool{"constraints": true}
+
+// promptArgDescriptions documenta los campos core que resuelve el engine.
+var promptArgDescriptions = map[string]string{
+	"role":        "Rol del agente o sistema que ejecutará el prompt",
+	"context":     "Contexto de negocio o técnico relevante para el prompt",
+	"task":        "Tarea concreta a resolver",
+	"constraints": "Restricciones, una por línea",
+}
+
+type promptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+}
+
+func templateArguments(content string) []promptArgument {
+	names := engine.Placeholders(content)
+	args := make([]promptArgument, 0, len(names))
+	for _, name := range names {
+		desc := promptArgDescriptions[name]
+		if desc == "" {
+			desc = fmt.Sprintf("Valor de {{%s}}", name)
+		}
+		args = append(args, promptArgument{Name: name, Description: desc, Required: !optionalPromptArgs[name]})
+	}
+	return args
+}
+
+func (s *Server) handlePromptsList(req *request) {
+	all := s.templates.Templates()
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	prompts := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		tmpl := all[name]
+		prompts = append(prompts, map[string]interface{}{
+			"name":        name,
+			"description": tmpl.Description,
+			"arguments":   templateArguments(tmpl.Content),
+		})
+	}
+
+	s.audit(AuditEvent{
+		Type:   "MCP",
+		Action: "PROMPTS_LIST_REQUESTED",
+		Actor:  req.session.Client(),
+		Result: "OK",
+		Detail: fmt.Sprintf("%d templates publicados como prompts", len(prompts)),
+	})
+	req.respond(map[string]interface{}{"prompts": prompts})
+}
+
+func (s *Server) handlePromptsGet(req *request) {
+	var params struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		req.fail(CodeInvalidParams, "parámetros de prompts/get inválidos", err.Error())
+		return
+	}
+
+	tmpl, ok := s.templates.Template(params.Name)
+	if !ok {
+		s.audit(AuditEvent{
+			Type:     "TEMPLATE",
+			Action:   "PROMPT_NOT_FOUND",
+			Actor:    "promptc-engine",
+			Resource: params.Name,
+			Result:   "FAIL",
+			Detail:   "Prompt solicitado no existe en templates.json",
+		})
+		req.fail(CodeInvalidParams, fmt.Sprintf("prompt '%s' no encontrado", params.Name), nil)
+		return
+	}
+
+	var missing []string
+	for _, arg := range templateArguments(tmpl.Content) {
+		if arg.Required && strings.TrimSpace(params.Arguments[arg.Name]) == "" {
+			missing = append(missing, arg.Name)
+		}
+	}
+	if len(missing) > 0 {
+		req.fail(CodeInvalidParams, "faltan argumentos requeridos", map[string]interface{}{"missing": missing})
+		return
+	}
+
+	p := core.Prompt{
+		Role:      params.Arguments["role"],
+		Context:   params.Arguments["context"],
+		Task:      params.Arguments["task"],
+		Variables: make(map[string]string, len(params.Arguments)),
+	}
+	for k, v := range params.Arguments {
+		// constraints se formatea como lista con viñetas, no como texto crudo
+		if k != "constraints" {
+			p.Variables[k] = v
+		}
+	}
+	for _, line := range strings.Split(params.Arguments["constraints"], "\n") {
+		if line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*•")); line != "" {
+			p.Constraints = append(p.Constraints, line)
+		}
+	}
+	text := s.engine().ResolveVariables(tmpl.Content, p)
+
+	s.metrics.RecordTemplateCall(params.Name)
+	s.audit(AuditEvent{
+		Type:     "TEMPLATE",
+		Action:   "PROMPT_SERVED",
+		Actor:    "promptc-engine",
+		Resource: params.Name,
+		Result:   "OK",
+		Detail:   fmt.Sprintf("argumentos=%d content_len=%d", len(params.Arguments), len(text)),
+	})
+	req.respond(map[string]interface{}{
+		"description": tmpl.Description,
+		"messages": []map[string]interface{}{
+			{
+				"role":    "user",
+				"content": map[string]string{"type": "text", "text": text},
+			},
+		},
+	})
+}
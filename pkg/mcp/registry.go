@@ -0,0 +1,188 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// --- REGISTRO DE HERRAMIENTAS ---
+// Cada herramienta se declara una sola vez: su tipo de argumentos, su
+// handler y, si responde JSON, su tipo de resultado. tools/list, la
+// validación previa al despacho y el plazo salen de esa declaración.
+
+// toolSpec es la metadata de una herramienta.
+type toolSpec struct {
+	Name        string
+	Description string
+	// Timeout es el plazo de la llamada; 0 usa defaultToolTimeout.
+	Timeout time.Duration
+	// Required reemplaza los required:"true" del tipo cuando el mismo tipo
+	// de argumentos sirve a varias herramientas.
+	Required []string
+}
+
+type registeredTool struct {
+	toolSpec
+	inputSchema  map[string]interface{}
+	outputSchema map[string]interface{} // nil: la herramienta responde texto
+	call         func(ctx context.Context, req *request, args json.RawMessage)
+}
+
+// toolSet son las herramientas de un Server, en orden de registro.
+type toolSet struct {
+	order  []string
+	byName map[string]*registeredTool
+}
+
+// paramsError es un argumento semánticamente inválido: se responde -32602
+// en vez de un resultado con isError.
+type paramsError struct {
+	message string
+	data    interface{}
+}
+
+func (e *paramsError) Error() string { return e.message }
+
+func invalidParams(message string, data interface{}) error {
+	return &paramsError{message: message, data: data}
+}
+
+// registerTool declara una herramienta que responde texto.
+func registerTool[A any](s *Server, spec toolSpec, handler func(ctx context.Context, req *request, args A) (string, error)) {
+	addTool(s, spec, reflect.TypeFor[A](), nil, func(ctx context.Context, req *request, args A) {
+		text, err := handler(ctx, req, args)
+		if respondToolError(req, err) {
+			return
+		}
+		req.toolResult(text)
+	})
+}
+
+// registerStructuredTool declara una herramienta que responde un objeto
+// JSON; su tipo O se publica como outputSchema.
+func registerStructuredTool[A, O any](s *Server, spec toolSpec, handler func(ctx context.Context, req *request, args A) (O, error)) {
+	addTool(s, spec, reflect.TypeFor[A](), reflect.TypeFor[O](), func(ctx context.Context, req *request, args A) {
+		out, err := handler(ctx, req, args)
+		if respondToolError(req, err) {
+			return
+		}
+		req.toolStructured(out)
+	})
+}
+
+func addTool[A any](s *Server, spec toolSpec, argsType, outType reflect.Type, run func(ctx context.Context, req *request, args A)) {
+	if _, dup := s.tools.byName[spec.Name]; dup {
+		panic(fmt.Sprintf("herramienta %q registrada dos veces", spec.Name))
+	}
+	tool := &registeredTool{toolSpec: spec, inputSchema: jsonSchema(argsType, false)}
+	if spec.Required != nil {
+		delete(tool.inputSchema, "required")
+		if len(spec.Required) > 0 {
+			tool.inputSchema["required"] = spec.Required
+		}
+	}
+	if outType != nil {
+		tool.outputSchema = jsonSchema(outType, true)
+	}
+	tool.call = func(ctx context.Context, req *request, raw json.RawMessage) {
+		if errs := validateArgs(tool.inputSchema, raw); len(errs) > 0 {
+			s.audit(AuditEvent{
+				Type:     "MCP",
+				Action:   "TOOL_ARGS_INVALID",
+				Actor:    req.session.Client(),
+				Resource: spec.Name,
+				Result:   "FAIL",
+				Detail:   strings.Join(errs, "; "),
+			})
+			req.fail(CodeInvalidParams, "argumentos inválidos", map[string]interface{}{"errors": errs})
+			return
+		}
+		if len(raw) == 0 {
+			raw = json.RawMessage("{}")
+		}
+		var args A
+		if err := json.Unmarshal(raw, &args); err != nil {
+			req.fail(CodeInvalidParams, "argumentos inválidos", err.Error())
+			return
+		}
+		run(ctx, req, args)
+	}
+	s.tools.order = append(s.tools.order, spec.Name)
+	s.tools.byName[spec.Name] = tool
+}
+
+// respondToolError responde err si no es nil: -32602 para paramsError,
+// resultado con isError para el resto.
+func respondToolError(req *request, err error) bool {
+	if err == nil {
+		return false
+	}
+	var pe *paramsError
+	if errors.As(err, &pe) {
+		req.fail(CodeInvalidParams, pe.message, pe.data)
+	} else {
+		req.toolError(err.Error())
+	}
+	return true
+}
+
+func (t *toolSet) lookup(name string) (*registeredTool, bool) {
+	tool, ok := t.byName[name]
+	return tool, ok
+}
+
+// descriptors arma la respuesta de tools/list en orden de registro;
+// outputSchema solo va a clientes que negociaron esa capacidad.
+func (t *toolSet) descriptors(withOutputSchema bool) []map[string]interface{} {
+	tools := make([]map[string]interface{}, 0, len(t.order))
+	for _, name := range t.order {
+		tool := t.byName[name]
+		desc := map[string]interface{}{
+			"name":        tool.Name,
+			"description": tool.Description,
+			"inputSchema": tool.inputSchema,
+		}
+		if withOutputSchema && tool.outputSchema != nil {
+			desc["outputSchema"] = tool.outputSchema
+		}
+		tools = append(tools, desc)
+	}
+	return tools
+}
+
+// registerTools declara el catálogo de herramientas de PROMPTC.
+func (s *Server) registerTools() {
+	registerTool(s, toolSpec{
+		Name:        "get_template",
+		Description: "Obtiene una plantilla industrial por nombre desde el almacén local.",
+		Timeout:     5 * time.Second,
+	}, s.toolGetTemplate)
+	registerTool(s, toolSpec{
+		Name:        "optimize_prompt",
+		Description: "Compila y optimiza un prompt usando el Mac Mini vía Tailscale con fallback a Gemini. Acepta template_name para usar una plantilla como base con resolución automática de variables.",
+		Timeout:     90 * time.Second,
+	}, s.toolOptimizePrompt)
+	registerStructuredTool(s, toolSpec{
+		Name:        "lint_prompt",
+		Description: "Analiza un prompt sin llamar a ningún modelo: retorna score, hallazgos, sugerencias y variables sin resolver.",
+	}, s.toolLintPrompt)
+	registerStructuredTool(s, toolSpec{
+		Name:        "compile_prompt",
+		Description: "Compila un prompt de forma determinista (### ROLE/CONTEXT/TASK/CONSTRAINTS) sin inferencia. Úsalo antes de optimize_prompt si el score ya es confiable.",
+		Required:    []string{"role", "context"},
+	}, s.toolCompilePrompt)
+	registerStructuredTool(s, toolSpec{
+		Name:        "list_templates",
+		Description: "Lista los templates registrados con su descripción y las variables que requieren.",
+	}, s.toolListTemplates)
+	registerStructuredTool(s, toolSpec{
+		Name:        "render_template",
+		Description: "Resuelve los {{placeholders}} de un template con las variables dadas y reporta las que faltan. No llama a ningún modelo.",
+		Required:    []string{"template_name"},
+	}, s.toolRenderTemplate)
+}
@@ -0,0 +1,217 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- MCP RESOURCES ---
+// El almacén de templates, la cola del audit log y las métricas se publican
+// como recursos de solo lectura. Los clientes suscritos reciben
+// notifications/resources/updated cuando cambian.
+
+const (
+	templateURIPrefix = "promptc://templates/"
+	auditURI          = "promptc://audit/recent"
+	metricsURI        = "promptc://metrics"
+
+	recentAuditSize = 100
+	// resourceDebounce agrupa ráfagas de cambios (cada evento de auditoría
+	// actualiza promptc://audit/recent) en una sola notificación.
+	resourceDebounce = time.Second
+)
+
+func templateURI(name string) string {
+	return templateURIPrefix + url.PathEscape(name)
+}
+
+// --- COLA DE AUDITORÍA EN MEMORIA ---
+
+// RecordAudit guarda los últimos eventos para promptc://audit/recent. El
+// auditor del binario lo llama con todos los eventos, no solo los del
+// servidor MCP.
+func (s *Server) RecordAudit(evt AuditEvent) {
+	s.recentAudit.Lock()
+	s.recentAudit.events = append(s.recentAudit.events, evt)
+	if over := len(s.recentAudit.events) - recentAuditSize; over > 0 {
+		s.recentAudit.events = append([]AuditEvent(nil), s.recentAudit.events[over:]...)
+	}
+	s.recentAudit.Unlock()
+	s.notifyResourceUpdated(auditURI)
+}
+
+// --- SUSCRIPCIONES ---
+
+// notifyResourceUpdated avisa a las sesiones suscritas a uri, a lo más una
+// vez por resourceDebounce.
+func (s *Server) notifyResourceUpdated(uri string) {
+	if !s.anySubscribed(uri) {
+		return
+	}
+	s.pendingUpdates.Lock()
+	defer s.pendingUpdates.Unlock()
+	if s.pendingUpdates.uris[uri] {
+		return
+	}
+	s.pendingUpdates.uris[uri] = true
+	time.AfterFunc(resourceDebounce, func() {
+		s.pendingUpdates.Lock()
+		delete(s.pendingUpdates.uris, uri)
+		s.pendingUpdates.Unlock()
+		for _, sess := range s.allSessions() {
+			if sess.subscribed(uri) {
+				sess.sendNotification("notifications/resources/updated", map[string]string{"uri": uri})
+			}
+		}
+	})
+}
+
+func (s *Server) anySubscribed(uri string) bool {
+	for _, sess := range s.allSessions() {
+		if sess.subscribed(uri) {
+			return true
+		}
+	}
+	return false
+}
+
+// MetricsChanged avisa a los suscriptores de promptc://metrics de un cambio
+// registrado fuera del servidor, como el nodo local que se cae o vuelve en
+// el heartbeat.
+func (s *Server) MetricsChanged() {
+	s.notifyResourceUpdated(metricsURI)
+}
+
+// TemplatesChanged avisa a los clientes de un hot reload del almacén: la
+// lista de prompts cambió, cada template modificado se notifica como
+// recurso actualizado y, si cambió el conjunto de nombres, también la
+// lista de recursos.
+func (s *Server) TemplatesChanged(before, after map[string]Template) {
+	s.broadcastNotification("notifications/prompts/list_changed", nil)
+	listChanged := len(before) != len(after)
+	for name, old := range before {
+		cur, ok := after[name]
+		if !ok {
+			listChanged = true
+			continue
+		}
+		if cur != old {
+			s.notifyResourceUpdated(templateURI(name))
+		}
+	}
+	if listChanged {
+		s.broadcastNotification("notifications/resources/list_changed", nil)
+	}
+}
+
+// --- HANDLERS ---
+
+type resourceDescriptor struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+func (s *Server) handleResourcesList(req *request) {
+	all := s.templates.Templates()
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	resources := make([]resourceDescriptor, 0, len(names)+2)
+	for _, name := range names {
+		resources = append(resources, resourceDescriptor{
+			URI:         templateURI(name),
+			Name:        name,
+			Description: all[name].Description,
+			MimeType:    "text/markdown",
+		})
+	}
+
+	resources = append(resources,
+		resourceDescriptor{URI: auditURI, Name: "Audit log (recientes)", Description: fmt.Sprintf("Últimos %d eventos de auditoría", recentAuditSize), MimeType: "application/json"},
+		resourceDescriptor{URI: metricsURI, Name: "Métricas", Description: "Inferencias, latencia, caché, gasto y pool de workers", MimeType: "application/json"},
+	)
+	req.respond(map[string]interface{}{"resources": resources})
+}
+
+func (s *Server) handleResourceTemplatesList(req *request) {
+	req.respond(map[string]interface{}{
+		"resourceTemplates": []map[string]string{
+			{
+				"uriTemplate": templateURIPrefix + "{name}",
+				"name":        "Template industrial",
+				"description": "Contenido de un template de templates.json, con sus {{placeholders}} sin resolver",
+				"mimeType":    "text/markdown",
+			},
+		},
+	})
+}
+
+func (s *Server) handleResourcesRead(req *request) {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.URI == "" {
+		req.fail(CodeInvalidParams, "resources/read requiere uri", nil)
+		return
+	}
+
+	var mimeType, text string
+	switch {
+	case params.URI == auditURI:
+		s.recentAudit.Lock()
+		data, _ := json.MarshalIndent(s.recentAudit.events, "", "  ")
+		s.recentAudit.Unlock()
+		mimeType, text = "application/json", string(data)
+
+	case params.URI == metricsURI:
+		data, _ := json.MarshalIndent(s.metrics.Snapshot(), "", "  ")
+		mimeType, text = "application/json", string(data)
+
+	case strings.HasPrefix(params.URI, templateURIPrefix):
+		name, err := url.PathUnescape(strings.TrimPrefix(params.URI, templateURIPrefix))
+		tmpl, ok := s.templates.Template(name)
+		if err != nil || !ok {
+			req.fail(CodeResourceNotFound, "recurso no encontrado", map[string]string{"uri": params.URI})
+			return
+		}
+		mimeType, text = "text/markdown", tmpl.Content
+
+	default:
+		req.fail(CodeResourceNotFound, "recurso no encontrado", map[string]string{"uri": params.URI})
+		return
+	}
+
+	req.respond(map[string]interface{}{
+		"contents": []map[string]string{
+			{"uri": params.URI, "mimeType": mimeType, "text": text},
+		},
+	})
+}
+
+func (s *Server) handleResourceSubscription(req *request) {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.URI == "" {
+		req.fail(CodeInvalidParams, req.Method+" requiere uri", nil)
+		return
+	}
+	req.session.setSubscribed(params.URI, req.Method == "resources/subscribe")
+
+	s.audit(AuditEvent{
+		Type:     "MCP",
+		Action:   strings.ToUpper(strings.TrimPrefix(req.Method, "resources/")),
+		Actor:    req.session.Client(),
+		Resource: params.URI,
+		Result:   "OK",
+	})
+	req.respond(map[string]interface{}{})
+}
@@ -0,0 +1,182 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// --- JSON SCHEMA POR REFLEXIÓN ---
+// Los inputSchema y outputSchema de las herramientas se generan desde los
+// tipos Go de sus argumentos y resultados, para que el schema publicado y
+// el struct que se deserializa no puedan divergir. Etiquetas:
+//
+//	json:"nombre,omitempty"  nombre de la propiedad (igual que encoding/json)
+//	desc:"..."               descripción para el modelo
+//	required:"true"          argumento requerido
+
+// jsonSchema genera el schema de t. Con requireAll (schemas de salida) toda
+// propiedad sin omitempty es requerida, sin necesidad de etiquetarla.
+func jsonSchema(t reflect.Type, requireAll bool) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem(), requireAll)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchema(t.Elem(), requireAll)}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		var required []string
+		addSchemaFields(t, properties, &required, requireAll)
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		// interface{}: cualquier valor JSON
+		return map[string]interface{}{}
+	}
+}
+
+// addSchemaFields recorre los campos de t; los structs embebidos sin
+// etiqueta json aportan sus campos al mismo nivel, como en encoding/json.
+func addSchemaFields(t reflect.Type, properties map[string]interface{}, required *[]string, requireAll bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addSchemaFields(ft, properties, required, requireAll)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop := jsonSchema(f.Type, requireAll)
+		if desc := f.Tag.Get("desc"); desc != "" {
+			prop["description"] = desc
+		}
+		properties[name] = prop
+		if f.Tag.Get("required") == "true" || (requireAll && !strings.Contains(opts, "omitempty")) {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// validateArgs revisa los argumentos crudos contra schema antes de
+// deserializarlos. Retorna un mensaje por cada problema, con la ruta del
+// valor (ej: "constraints[2]: se esperaba string").
+func validateArgs(schema map[string]interface{}, raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		raw = json.RawMessage("{}")
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return []string{fmt.Sprintf("JSON inválido: %v", err)}
+	}
+	var errs []string
+	validateValue(schema, v, "", &errs)
+	return errs
+}
+
+func validateValue(schema map[string]interface{}, v interface{}, path string, errs *[]string) {
+	at := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		if path != "" {
+			msg = path + ": " + msg
+		}
+		*errs = append(*errs, msg)
+	}
+
+	switch schema["type"] {
+	case "string":
+		if _, ok := v.(string); !ok {
+			at("se esperaba string")
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			at("se esperaba boolean")
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			at("se esperaba número")
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != math.Trunc(n) {
+			at("se esperaba entero")
+		}
+	case "array":
+		list, ok := v.([]interface{})
+		if !ok {
+			at("se esperaba arreglo")
+			return
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range list {
+				validateValue(items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			at("se esperaba objeto")
+			return
+		}
+		required, _ := schema["required"].([]string)
+		for _, name := range required {
+			if val, ok := obj[name]; !ok || val == nil {
+				at("falta el argumento requerido %s", name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		extra, _ := schema["additionalProperties"].(map[string]interface{})
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			val := obj[name]
+			if val == nil {
+				// null equivale a omitir un argumento opcional
+				continue
+			}
+			child := name
+			if path != "" {
+				child = path + "." + name
+			}
+			if prop, ok := properties[name].(map[string]interface{}); ok {
+				validateValue(prop, val, child, errs)
+			} else if extra != nil {
+				validateValue(extra, val, child, errs)
+			}
+		}
+	}
+}
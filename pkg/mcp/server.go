@@ -0,0 +1,379 @@
+// Package mcp implementa el servidor Model Context Protocol de PROMPTC.
+//
+// El Server no depende de variables globales ni de stdout: recibe el
+// almacén de templates, el SDK, el auditor y las métricas por Config, y
+// atiende clientes por cualquier io.Reader/io.Writer (Serve) o por
+// Streamable HTTP (Handler). Client conecta un cliente en memoria para
+// pruebas y para embeber PROMPTC en otro proceso Go.
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andesdevroot/promptc/pkg/sdk"
+)
+
+// Template es una plantilla industrial del almacén.
+type Template struct {
+	Description string `json:"description"`
+	Content     string `json:"content"`
+}
+
+// TemplateStore es el almacén de templates (templates.json en el binario).
+type TemplateStore interface {
+	// Template retorna una plantilla por nombre.
+	Template(name string) (Template, bool)
+	// Templates retorna una copia de todas las plantillas.
+	Templates() map[string]Template
+}
+
+// AuditEvent representa un evento estructurado de auditoría.
+// Cada evento tiene tipo semántico, actor, recurso y resultado.
+type AuditEvent struct {
+	Timestamp string `json:"ts"`
+	Type      string `json:"type"` // KERNEL | MCP | TEMPLATE | INFERENCE | POLICY | SYSTEM
+	Action    string `json:"action"`
+	Actor     string `json:"actor"` // clientInfo.name | promptc-engine | mac-mini | gemini
+	Resource  string `json:"resource,omitempty"`
+	Result    string `json:"result"` // OK | FAIL | WARN
+	LatencyMs int64  `json:"latency_ms,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// Auditor recibe los eventos que genera el servidor.
+type Auditor interface {
+	Audit(evt AuditEvent)
+}
+
+// AuditorFunc adapta una función a Auditor.
+type AuditorFunc func(evt AuditEvent)
+
+func (f AuditorFunc) Audit(evt AuditEvent) { f(evt) }
+
+// Metrics acumula los contadores que el servidor reporta.
+type Metrics interface {
+	RecordInference(success bool, latencyMs, tokens int64, usedCloud bool)
+	RecordTemplateCall(name string)
+	// NodeOnline indica si el nodo local de inferencia responde al heartbeat.
+	NodeOnline() bool
+	// Snapshot es el contenido del recurso promptc://metrics.
+	Snapshot() interface{}
+}
+
+// StreamEvent describe el avance de una inferencia en curso, para el
+// dashboard. Kind es start | token | end.
+type StreamEvent struct {
+	Kind     string `json:"kind"`
+	ID       string `json:"id"`
+	Resource string `json:"resource,omitempty"`
+	Chunk    string `json:"chunk,omitempty"`
+	Result   string `json:"result,omitempty"`
+}
+
+// Config son las dependencias del Server.
+type Config struct {
+	Name    string // serverInfo.name; default "PROMPTC"
+	Version string // serverInfo.version; default "0.3.0"
+
+	Templates TemplateStore // requerido
+	SDK       *sdk.PromptC  // nil: optimize_prompt responde error y las herramientas deterministas usan un engine por defecto
+	Auditor   Auditor       // nil: los eventos se descartan
+	Metrics   Metrics       // nil: sin métricas
+	// OnStream recibe los chunks de optimize_prompt a medida que llegan.
+	OnStream func(StreamEvent)
+
+	// DefaultTeam selecciona la instrucción cuando optimize_prompt no trae team.
+	DefaultTeam string
+	// OptimizeTimeout reemplaza el plazo de optimize_prompt (incluye la
+	// espera en el pool de inferencia).
+	OptimizeTimeout time.Duration
+	// StdioClient nombra en el audit log al cliente de Serve antes de que
+	// envíe su clientInfo; default "claude-desktop".
+	StdioClient string
+}
+
+// Server es un servidor MCP. Es seguro para uso concurrente: cada llamada
+// a Serve y cada sesión HTTP es una sesión independiente.
+type Server struct {
+	name, version string
+	templates     TemplateStore
+	app           *sdk.PromptC
+	auditor       Auditor
+	metrics       Metrics
+	onStream      func(StreamEvent)
+
+	defaultTeam     string
+	optimizeTimeout time.Duration
+	stdioClient     string
+
+	tools toolSet
+
+	sessions struct {
+		sync.Mutex
+		byID map[string]*session
+	}
+	pendingUpdates struct {
+		sync.Mutex
+		uris map[string]bool
+	}
+	recentAudit struct {
+		sync.Mutex
+		events []AuditEvent
+	}
+	janitor sync.Once
+}
+
+// NewServer arma un servidor con las herramientas, prompts y recursos de PROMPTC.
+func NewServer(cfg Config) *Server {
+	s := &Server{
+		name:            cfg.Name,
+		version:         cfg.Version,
+		templates:       cfg.Templates,
+		app:             cfg.SDK,
+		auditor:         cfg.Auditor,
+		metrics:         cfg.Metrics,
+		onStream:        cfg.OnStream,
+		defaultTeam:     cfg.DefaultTeam,
+		optimizeTimeout: cfg.OptimizeTimeout,
+		stdioClient:     cfg.StdioClient,
+		tools:           toolSet{byName: map[string]*registeredTool{}},
+	}
+	if s.name == "" {
+		s.name = "PROMPTC"
+	}
+	if s.version == "" {
+		s.version = "0.3.0"
+	}
+	if s.auditor == nil {
+		s.auditor = AuditorFunc(func(AuditEvent) {})
+	}
+	if s.metrics == nil {
+		s.metrics = nopMetrics{}
+	}
+	if s.onStream == nil {
+		s.onStream = func(StreamEvent) {}
+	}
+	if s.stdioClient == "" {
+		s.stdioClient = "claude-desktop"
+	}
+	s.sessions.byID = map[string]*session{}
+	s.pendingUpdates.uris = map[string]bool{}
+	s.registerTools()
+	return s
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) RecordInference(bool, int64, int64, bool) {}
+func (nopMetrics) RecordTemplateCall(string)                {}
+func (nopMetrics) NodeOnline() bool                         { return false }
+func (nopMetrics) Snapshot() interface{}                    { return map[string]interface{}{} }
+
+func (s *Server) audit(evt AuditEvent) {
+	s.auditor.Audit(evt)
+}
+
+// SessionCount retorna las sesiones abiertas (stdio y HTTP).
+func (s *Server) SessionCount() int {
+	s.sessions.Lock()
+	defer s.sessions.Unlock()
+	return len(s.sessions.byID)
+}
+
+// Serve atiende un cliente JSON-RPC delimitado por líneas (stdio) hasta que
+// r se cierra. Antes de retornar espera a que terminen las solicitudes en
+// curso, para no perder sus respuestas.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	var mu sync.Mutex
+	write := func(v interface{}) {
+		out, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+		// Dos respuestas concurrentes no se intercalan en la misma línea
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "%s\n", out)
+	}
+
+	sess := s.registerSession(newSession(newSessionID(), "stdio", s.stdioClient, write))
+	defer s.closeSession(sess.ID)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] == '[' {
+			write(errorResponse(nil, CodeInvalidRequest, "batch JSON-RPC no soportado", nil))
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			write(errorResponse(nil, CodeParseError, "JSON inválido", err.Error()))
+			continue
+		}
+		s.handleMessage(&request{Message: msg, session: sess, write: write})
+	}
+	// r cerrado: se dejan terminar las solicitudes en curso antes de salir
+	sess.inflight.wait()
+	return scanner.Err()
+}
+
+// handleInitialize negocia la revisión del protocolo y registra quién es el
+// cliente; desde aquí el audit log lo nombra por su clientInfo.
+func (s *Server) handleInitialize(req *request) {
+	var params initializeParams
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			req.fail(CodeInvalidParams, "parámetros de initialize inválidos", err.Error())
+			return
+		}
+	}
+	version := req.session.handshake(params)
+
+	result := "OK"
+	detail := fmt.Sprintf("Protocolo MCP %s negociado", version)
+	if params.ProtocolVersion != version {
+		result = "WARN"
+		detail += fmt.Sprintf(" (cliente pidió %q, no soportada)", params.ProtocolVersion)
+	}
+	if params.ClientInfo.Name != "" {
+		detail += fmt.Sprintf(" — cliente=%s %s", params.ClientInfo.Name, params.ClientInfo.Version)
+	}
+	if caps := req.session.clientCapabilities(); len(caps) > 0 {
+		detail += fmt.Sprintf(" capabilities=%s", strings.Join(caps, ","))
+	}
+	s.audit(AuditEvent{
+		Type:     "MCP",
+		Action:   "HANDSHAKE_INIT",
+		Actor:    req.session.Client(),
+		Resource: req.session.Transport,
+		Result:   result,
+		Detail:   detail,
+	})
+	req.respond(map[string]interface{}{
+		"protocolVersion": version,
+		"serverInfo":      map[string]string{"name": s.name, "version": s.version},
+		"capabilities": map[string]interface{}{
+			"tools":   map[string]interface{}{},
+			"prompts": map[string]interface{}{"listChanged": true},
+			"resources": map[string]interface{}{
+				"subscribe":   true,
+				"listChanged": true,
+			},
+		},
+	})
+}
+
+// handleMessage atiende un mensaje JSON-RPC de cualquier transporte. Las
+// solicitudes se responden por req.write; tools/call corre en su propia
+// goroutine y responde al terminar.
+func (s *Server) handleMessage(req *request) {
+	req.session.touch()
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		// Sin ID tampoco hay a quién responder (p. ej. una respuesta del cliente)
+		if req.ID != nil {
+			req.fail(CodeInvalidRequest, "solicitud JSON-RPC 2.0 inválida", nil)
+		}
+		req.finish()
+		return
+	}
+
+	switch req.Method {
+	case "initialize":
+		s.handleInitialize(req)
+
+	case "notifications/initialized":
+		req.session.ready.Store(true)
+		s.audit(AuditEvent{
+			Type:   "MCP",
+			Action: "HANDSHAKE_CONFIRMED",
+			Actor:  req.session.Client(),
+			Result: "OK",
+			Detail: "Canal MCP establecido — herramientas disponibles",
+		})
+
+	case "tools/list":
+		tools := s.tools.descriptors(req.session.supports(featureStructuredContent))
+		names := make([]string, 0, len(tools))
+		for _, tool := range tools {
+			names = append(names, tool["name"].(string))
+		}
+		s.audit(AuditEvent{
+			Type:   "MCP",
+			Action: "TOOLS_LIST_REQUESTED",
+			Actor:  req.session.Client(),
+			Result: "OK",
+			Detail: fmt.Sprintf("Enviando schema de %d herramientas: %s", len(tools), strings.Join(names, ", ")),
+		})
+		req.respond(map[string]interface{}{"tools": tools})
+
+	case "notifications/cancelled":
+		s.handleCancelled(req)
+
+	case "prompts/list":
+		s.handlePromptsList(req)
+
+	case "prompts/get":
+		s.handlePromptsGet(req)
+
+	case "resources/list":
+		s.handleResourcesList(req)
+
+	case "resources/templates/list":
+		s.handleResourceTemplatesList(req)
+
+	case "resources/read":
+		s.handleResourcesRead(req)
+
+	case "resources/subscribe", "resources/unsubscribe":
+		s.handleResourceSubscription(req)
+
+	case "ping":
+		req.respond(map[string]interface{}{})
+
+	case "tools/call":
+		// Concurrente: una optimización larga no bloquea get_template ni tools/list
+		req.session.inflight.dispatch(req.ID, func(ctx context.Context) {
+			defer s.recoverInternalError(req)
+			s.handleToolCall(ctx, req)
+		})
+
+	default:
+		// Las notificaciones desconocidas se ignoran; las solicitudes siempre se responden
+		if req.ID != nil {
+			req.fail(CodeMethodNotFound, fmt.Sprintf("método '%s' no soportado", req.Method), nil)
+		}
+	}
+	if req.ID == nil {
+		// Notificación: no hay respuesta que esperar
+		req.finish()
+	}
+}
+
+// recoverInternalError convierte un panic de un handler en -32603 para que
+// el cliente no espere una respuesta que nunca llegará.
+func (s *Server) recoverInternalError(req *request) {
+	if rec := recover(); rec != nil {
+		s.audit(AuditEvent{
+			Type:     "MCP",
+			Action:   "HANDLER_PANIC",
+			Actor:    "promptc-engine",
+			Resource: fmt.Sprintf("%v", req.ID),
+			Result:   "FAIL",
+			Detail:   fmt.Sprintf("%v", rec),
+		})
+		req.fail(CodeInternalError, "error interno del servidor", fmt.Sprintf("%v", rec))
+	}
+}
@@ -0,0 +1,369 @@
+package mcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andesdevroot/promptc/pkg/mcp"
+)
+
+// fakeTemplates es un almacén de templates en memoria.
+type fakeTemplates map[string]mcp.Template
+
+func (f fakeTemplates) Template(name string) (mcp.Template, bool) {
+	t, ok := f[name]
+	return t, ok
+}
+
+func (f fakeTemplates) Templates() map[string]mcp.Template {
+	out := make(map[string]mcp.Template, len(f))
+	for k, v := range f {
+		out[k] = v
+	}
+	return out
+}
+
+// recordingAuditor guarda los eventos; tools/call corre en su propia
+// goroutine, así que el acceso va con mutex.
+type recordingAuditor struct {
+	mu     sync.Mutex
+	events []mcp.AuditEvent
+}
+
+func (a *recordingAuditor) Audit(evt mcp.AuditEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.events = append(a.events, evt)
+}
+
+// find retorna el último evento con esa acción.
+func (a *recordingAuditor) find(action string) (mcp.AuditEvent, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := len(a.events) - 1; i >= 0; i-- {
+		if a.events[i].Action == action {
+			return a.events[i], true
+		}
+	}
+	return mcp.AuditEvent{}, false
+}
+
+var templates = fakeTemplates{
+	"incident_report": {
+		Description: "Informe de incidente",
+		Content:     "Redacta un informe del incidente {{incident_id}} en la faena {{site}}.",
+	},
+	"with_task": {
+		Description: "Template que delega la tarea",
+		Content:     "Objetivo: {{task}}. Formato: {{format}}.",
+	},
+}
+
+// connect arma un servidor sin SDK y un cliente en memoria ya inicializado
+// con la revisión pedida.
+func connect(t *testing.T, protocol string) (*mcp.Client, *mcp.InitializeResult, *recordingAuditor) {
+	t.Helper()
+	auditor := &recordingAuditor{}
+	srv := mcp.NewServer(mcp.Config{Templates: templates, Auditor: auditor})
+	client := mcp.NewClient(srv)
+	t.Cleanup(func() {
+		if err := client.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	})
+	init, err := client.Initialize(testContext(t), protocol, mcp.ClientInfo{Name: "test-client", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	return client, init, auditor
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestInitializeNegotiatesProtocol(t *testing.T) {
+	cases := []struct {
+		requested, want, result string
+	}{
+		{"", "2025-06-18", "OK"},
+		{"2024-11-05", "2024-11-05", "OK"},
+		{"2025-03-26", "2025-03-26", "OK"},
+		{"1999-01-01", "2025-06-18", "WARN"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.requested, func(t *testing.T) {
+			_, init, auditor := connect(t, tc.requested)
+			if init.ProtocolVersion != tc.want {
+				t.Errorf("protocolVersion = %q, se esperaba %q", init.ProtocolVersion, tc.want)
+			}
+			if init.ServerInfo.Name != "PROMPTC" {
+				t.Errorf("serverInfo.name = %q", init.ServerInfo.Name)
+			}
+			for _, capability := range []string{"tools", "prompts", "resources"} {
+				if _, ok := init.Capabilities[capability]; !ok {
+					t.Errorf("falta la capacidad %s", capability)
+				}
+			}
+			evt, ok := auditor.find("HANDSHAKE_INIT")
+			if !ok {
+				t.Fatal("no se auditó HANDSHAKE_INIT")
+			}
+			if evt.Result != tc.result || evt.Actor != "test-client" {
+				t.Errorf("HANDSHAKE_INIT = %s por %s, se esperaba %s por test-client", evt.Result, evt.Actor, tc.result)
+			}
+		})
+	}
+}
+
+func TestListTools(t *testing.T) {
+	client, _, _ := connect(t, "")
+	tools, err := client.ListTools(testContext(t))
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	var names []string
+	byName := map[string]mcp.Tool{}
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+		byName[tool.Name] = tool
+	}
+	want := []string{"get_template", "optimize_prompt", "lint_prompt", "compile_prompt", "list_templates", "render_template"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("herramientas = %v, se esperaba %v", names, want)
+	}
+
+	get := byName["get_template"].InputSchema
+	if get["type"] != "object" {
+		t.Errorf("get_template: inputSchema.type = %v", get["type"])
+	}
+	if required := stringList(get["required"]); !slices.Equal(required, []string{"template_name"}) {
+		t.Errorf("get_template: required = %v", required)
+	}
+	props, _ := get["properties"].(map[string]interface{})
+	name, _ := props["template_name"].(map[string]interface{})
+	if name["type"] != "string" {
+		t.Errorf("get_template: template_name = %v", name)
+	}
+	if byName["get_template"].OutputSchema != nil {
+		t.Error("get_template responde texto: no debe publicar outputSchema")
+	}
+
+	optimize := byName["optimize_prompt"].InputSchema
+	if required := stringList(optimize["required"]); !slices.Equal(required, []string{"role", "context"}) {
+		t.Errorf("optimize_prompt: required = %v", required)
+	}
+
+	lint := byName["lint_prompt"].OutputSchema
+	if lint == nil {
+		t.Fatal("lint_prompt: falta outputSchema en 2025-06-18")
+	}
+	outProps, _ := lint["properties"].(map[string]interface{})
+	for _, field := range []string{"score", "is_reliable", "issues", "suggestions", "unresolved_variables"} {
+		if _, ok := outProps[field]; !ok {
+			t.Errorf("lint_prompt: outputSchema sin %s", field)
+		}
+	}
+}
+
+func TestListToolsOmitsOutputSchemaOnOldRevisions(t *testing.T) {
+	client, _, _ := connect(t, "2024-11-05")
+	tools, err := client.ListTools(testContext(t))
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	for _, tool := range tools {
+		if tool.OutputSchema != nil {
+			t.Errorf("%s: outputSchema publicado a un cliente 2024-11-05", tool.Name)
+		}
+	}
+}
+
+func TestGetTemplate(t *testing.T) {
+	client, _, auditor := connect(t, "")
+	ctx := testContext(t)
+
+	res, err := client.CallTool(ctx, "get_template", map[string]string{"template_name": "incident_report"})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("isError inesperado: %s", res.Text())
+	}
+	if res.Text() != templates["incident_report"].Content {
+		t.Errorf("contenido = %q", res.Text())
+	}
+	if evt, ok := auditor.find("GET_SERVED"); !ok || evt.Resource != "incident_report" {
+		t.Errorf("GET_SERVED = %+v, %v", evt, ok)
+	}
+
+	res, err = client.CallTool(ctx, "get_template", map[string]string{"template_name": "no_existe"})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if !res.IsError {
+		t.Fatal("un template desconocido debe responder isError")
+	}
+	if !strings.Contains(res.Text(), "no_existe") {
+		t.Errorf("mensaje = %q", res.Text())
+	}
+	if evt, ok := auditor.find("GET_NOT_FOUND"); !ok || evt.Result != "FAIL" {
+		t.Errorf("GET_NOT_FOUND = %+v, %v", evt, ok)
+	}
+}
+
+func TestGetTemplateMissingArgument(t *testing.T) {
+	client, _, auditor := connect(t, "")
+	_, err := client.CallTool(testContext(t), "get_template", map[string]string{})
+	var rpcErr *mcp.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != mcp.CodeInvalidParams {
+		t.Fatalf("err = %v, se esperaba -32602", err)
+	}
+	if _, ok := auditor.find("TOOL_ARGS_INVALID"); !ok {
+		t.Error("no se auditó TOOL_ARGS_INVALID")
+	}
+}
+
+func TestLintPrompt(t *testing.T) {
+	client, _, auditor := connect(t, "")
+	res, err := client.CallTool(testContext(t), "lint_prompt", map[string]interface{}{
+		"role":          "Ingeniero de Minas experto en Seguridad",
+		"context":       "Faena de cobre a rajo abierto",
+		"template_name": "incident_report",
+		"variables":     map[string]string{"incident_id": "INC-42"},
+	})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("isError inesperado: %s", res.Text())
+	}
+	var out struct {
+		Score               int      `json:"score"`
+		Issues              []string `json:"issues"`
+		UnresolvedVariables []string `json:"unresolved_variables"`
+	}
+	if err := json.Unmarshal(res.StructuredContent, &out); err != nil {
+		t.Fatalf("structuredContent: %v (%s)", err, res.StructuredContent)
+	}
+	if out.Score < 0 || out.Score > 100 {
+		t.Errorf("score = %d", out.Score)
+	}
+	if !slices.Equal(out.UnresolvedVariables, []string{"site"}) {
+		t.Errorf("unresolved_variables = %v, se esperaba [site]", out.UnresolvedVariables)
+	}
+	if _, ok := auditor.find("LINT"); !ok {
+		t.Error("no se auditó LINT")
+	}
+}
+
+func TestRenderTemplateTask(t *testing.T) {
+	client, _, _ := connect(t, "")
+	ctx := testContext(t)
+	cases := []struct {
+		name, task, text string
+		missing          []string
+	}{
+		{"con task", "resumir ventas", "Objetivo: resumir ventas. Formato: tabla.", []string{}},
+		// Sin task, {{task}} no se resuelve con el propio template
+		{"sin task", "", "Objetivo: [MISSING:task]. Formato: tabla.", []string{"task"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := client.CallTool(ctx, "render_template", map[string]interface{}{
+				"template_name": "with_task",
+				"task":          tc.task,
+				"variables":     map[string]string{"format": "tabla"},
+			})
+			if err != nil {
+				t.Fatalf("CallTool: %v", err)
+			}
+			var out struct {
+				Text             string   `json:"text"`
+				MissingVariables []string `json:"missing_variables"`
+			}
+			if err := json.Unmarshal(res.StructuredContent, &out); err != nil {
+				t.Fatalf("structuredContent: %v", err)
+			}
+			if out.Text != tc.text {
+				t.Errorf("text = %q, se esperaba %q", out.Text, tc.text)
+			}
+			if !slices.Equal(out.MissingVariables, tc.missing) {
+				t.Errorf("missing_variables = %v, se esperaba %v", out.MissingVariables, tc.missing)
+			}
+		})
+	}
+}
+
+func TestCompileFallsBackToTaskForUnknownTemplate(t *testing.T) {
+	client, _, auditor := connect(t, "")
+	res, err := client.CallTool(testContext(t), "compile_prompt", map[string]interface{}{
+		"role":          "Analista",
+		"context":       "Ventas",
+		"task":          "Resume las ventas del trimestre",
+		"template_name": "no_existe",
+	})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("isError inesperado: %s", res.Text())
+	}
+	var out struct {
+		Prompt string `json:"prompt"`
+	}
+	if err := json.Unmarshal(res.StructuredContent, &out); err != nil {
+		t.Fatalf("structuredContent: %v", err)
+	}
+	if !strings.Contains(out.Prompt, "Resume las ventas del trimestre") {
+		t.Errorf("prompt sin el task del argumento:\n%s", out.Prompt)
+	}
+	if strings.Contains(out.Prompt, "VARIABLES") {
+		t.Errorf("el task no debe aparecer como variable:\n%s", out.Prompt)
+	}
+	if evt, ok := auditor.find("INJECT_NOT_FOUND"); !ok || evt.Result != "WARN" {
+		t.Errorf("INJECT_NOT_FOUND = %+v, %v", evt, ok)
+	}
+}
+
+func TestOptimizeWithoutSDK(t *testing.T) {
+	client, _, _ := connect(t, "")
+	res, err := client.CallTool(testContext(t), "optimize_prompt", map[string]string{
+		"role":    "Analista",
+		"context": "Ventas",
+		"task":    "Resume",
+	})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if !res.IsError || !strings.Contains(res.Text(), "SDK no inicializado") {
+		t.Errorf("resultado = %+v", res)
+	}
+}
+
+func TestUnknownTool(t *testing.T) {
+	client, _, _ := connect(t, "")
+	_, err := client.CallTool(testContext(t), "no_existe", nil)
+	var rpcErr *mcp.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != mcp.CodeInvalidParams {
+		t.Fatalf("err = %v, se esperaba -32602", err)
+	}
+}
+
+func stringList(v interface{}) []string {
+	items, _ := v.([]interface{})
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		s, _ := item.(string)
+		out = append(out, s)
+	}
+	return out
+}
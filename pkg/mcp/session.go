@@ -0,0 +1,389 @@
+package mcp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// --- SESIONES MCP ---
+// Un mismo servidor atiende al cliente stdio (Claude Desktop) y a los
+// clientes Streamable HTTP del equipo. Cada conexión es una sesión con su
+// propio handshake, solicitudes en curso y suscripciones; los handlers solo
+// ven un *request y no saben por qué transporte responden.
+
+// session es un cliente MCP conectado.
+type session struct {
+	ID        string
+	Transport string // stdio | http
+
+	// ready se activa con notifications/initialized; antes de eso el
+	// servidor no debe enviar notificaciones propias.
+	ready    atomic.Bool
+	inflight *requestRegistry
+	lastSeen atomic.Int64
+
+	mu         sync.Mutex
+	clientKey  string // nombre del cliente para auditoría
+	clientInfo ClientInfo
+	clientCaps map[string]json.RawMessage
+	protocol   string // revisión MCP negociada en initialize
+	subs       map[string]bool
+	notify     func(v interface{}) // canal de notificaciones del servidor; nil si no hay
+	streamStop chan struct{}       // se cierra cuando otro stream GET reemplaza al actual
+}
+
+func newSession(id, transport, client string, notify func(v interface{})) *session {
+	s := &session{
+		ID:        id,
+		Transport: transport,
+		clientKey: client,
+		protocol:  oldestProtocol,
+		inflight:  newRequestRegistry(),
+		subs:      map[string]bool{},
+		notify:    notify,
+	}
+	s.touch()
+	return s
+}
+
+func (s *session) touch() {
+	s.lastSeen.Store(time.Now().UnixNano())
+}
+
+// Client identifica al cliente en auditoría: el clientInfo.name declarado en
+// initialize, con el prefijo de la sesión en HTTP para distinguir a dos
+// personas que usan la misma aplicación. Presupuestos y límites usan Account.
+func (s *session) Client() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clientKey
+}
+
+// Account identifica al cliente en presupuestos y límites por cliente: el
+// clientInfo.name sin el sufijo de sesión de Client, para que abrir una
+// sesión nueva no reinicie el límite ni reparta el gasto en cuentas
+// distintas.
+func (s *session) Account() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clientInfo.Name != "" {
+		return s.clientInfo.Name
+	}
+	if s.Transport == "http" {
+		return "mcp-http"
+	}
+	return s.clientKey
+}
+
+// Protocol retorna la revisión MCP negociada.
+func (s *session) Protocol() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.protocol
+}
+
+// supports indica si la revisión negociada incluye una capacidad que
+// apareció en la revisión since. Las revisiones son fechas ISO: se comparan
+// como texto.
+func (s *session) supports(since string) bool {
+	return s.Protocol() >= since
+}
+
+// attachStream conecta el stream GET de una sesión HTTP como canal de
+// notificaciones. Un stream nuevo reemplaza al anterior, que se cierra.
+func (s *session) attachStream(fn func(v interface{})) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.streamStop != nil {
+		close(s.streamStop)
+	}
+	s.streamStop = make(chan struct{})
+	s.notify = fn
+	return s.streamStop
+}
+
+// detachStream desconecta el stream si sigue siendo el actual.
+func (s *session) detachStream(stop <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.streamStop != nil && s.streamStop == stop {
+		s.streamStop = nil
+		s.notify = nil
+	}
+}
+
+func (s *session) streaming() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streamStop != nil
+}
+
+// close corta el canal de notificaciones y cancela lo que sigue en curso.
+func (s *session) close() {
+	s.inflight.cancelAll()
+	s.mu.Lock()
+	if s.streamStop != nil {
+		close(s.streamStop)
+		s.streamStop = nil
+	}
+	s.notify = nil
+	s.mu.Unlock()
+}
+
+// sendNotification envía una notificación del servidor. Se descarta si el
+// cliente no completó el handshake o no tiene un canal abierto.
+func (s *session) sendNotification(method string, params interface{}) {
+	if !s.ready.Load() {
+		return
+	}
+	s.mu.Lock()
+	notify := s.notify
+	s.mu.Unlock()
+	if notify != nil {
+		notify(Notification{JSONRPC: "2.0", Method: method, Params: params})
+	}
+}
+
+func (s *session) subscribed(uri string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subs[uri]
+}
+
+func (s *session) setSubscribed(uri string, on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if on {
+		s.subs[uri] = true
+	} else {
+		delete(s.subs, uri)
+	}
+}
+
+// --- REGISTRO DE SESIONES ---
+
+func (s *Server) registerSession(sess *session) *session {
+	s.sessions.Lock()
+	s.sessions.byID[sess.ID] = sess
+	s.sessions.Unlock()
+	return sess
+}
+
+func (s *Server) lookupSession(id string) (*session, bool) {
+	s.sessions.Lock()
+	defer s.sessions.Unlock()
+	sess, ok := s.sessions.byID[id]
+	return sess, ok
+}
+
+// closeSession saca la sesión del registro y cancela sus solicitudes en curso.
+func (s *Server) closeSession(id string) bool {
+	s.sessions.Lock()
+	sess, ok := s.sessions.byID[id]
+	delete(s.sessions.byID, id)
+	s.sessions.Unlock()
+	if ok {
+		sess.close()
+	}
+	return ok
+}
+
+// allSessions retorna una copia ordenada por ID para iterar sin el lock.
+func (s *Server) allSessions() []*session {
+	s.sessions.Lock()
+	out := make([]*session, 0, len(s.sessions.byID))
+	for _, sess := range s.sessions.byID {
+		out = append(out, sess)
+	}
+	s.sessions.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// broadcastNotification avisa a todas las sesiones inicializadas.
+func (s *Server) broadcastNotification(method string, params interface{}) {
+	for _, sess := range s.allSessions() {
+		sess.sendNotification(method, params)
+	}
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// --- NEGOCIACIÓN DE VERSIÓN ---
+
+// SupportedProtocols son las revisiones MCP que el servidor habla, de la
+// más nueva a la más antigua.
+var SupportedProtocols = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+const (
+	latestProtocol = "2025-06-18"
+	oldestProtocol = "2024-11-05"
+
+	// featureStructuredContent: structuredContent y outputSchema en tools.
+	featureStructuredContent = "2025-06-18"
+)
+
+// negotiateProtocol responde con la revisión pedida si el servidor la
+// soporta; si no, con la más nueva, y el cliente decide si continúa.
+func negotiateProtocol(requested string) string {
+	if protocolSupported(requested) {
+		return requested
+	}
+	return latestProtocol
+}
+
+func protocolSupported(v string) bool {
+	for _, p := range SupportedProtocols {
+		if p == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientInfo es la identificación que el cliente envía en initialize.
+type ClientInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// initializeParams son los parámetros de initialize.
+type initializeParams struct {
+	ProtocolVersion string                     `json:"protocolVersion"`
+	ClientInfo      ClientInfo                 `json:"clientInfo"`
+	Capabilities    map[string]json.RawMessage `json:"capabilities"`
+}
+
+// handshake registra lo negociado en initialize y retorna la revisión
+// acordada.
+func (s *session) handshake(p initializeParams) string {
+	version := negotiateProtocol(p.ProtocolVersion)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.protocol = version
+	s.clientInfo = p.ClientInfo
+	s.clientCaps = p.Capabilities
+	if name := p.ClientInfo.Name; name != "" {
+		s.clientKey = name
+		if s.Transport == "http" {
+			s.clientKey = name + "@" + s.ID[:8]
+		}
+	}
+	return version
+}
+
+// clientCapabilities lista las capacidades declaradas por el cliente, en
+// orden, para el audit log.
+func (s *session) clientCapabilities() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	caps := make([]string, 0, len(s.clientCaps))
+	for name := range s.clientCaps {
+		caps = append(caps, name)
+	}
+	sort.Strings(caps)
+	return caps
+}
+
+// --- SOLICITUD EN CURSO ---
+
+// request es un mensaje JSON-RPC recibido junto con el destino de su
+// respuesta: el writer de Serve o el cuerpo del POST para HTTP. Las
+// notificaciones ligadas a la solicitud (notifications/progress) viajan por
+// el mismo destino.
+type request struct {
+	Message
+	session *session
+	write   func(v interface{})
+
+	// Solo en tools/call
+	progressToken interface{}
+
+	once sync.Once
+	done chan struct{} // se cierra al responder; nil si el transporte no espera
+}
+
+// finish marca la solicitud como respondida (o descartada por cancelación).
+func (r *request) finish() {
+	if r.done != nil {
+		r.once.Do(func() { close(r.done) })
+	}
+}
+
+// respond descarta la respuesta si el cliente canceló la solicitud:
+// el protocolo MCP indica no responder a una solicitud cancelada.
+func (r *request) respond(result interface{}) {
+	defer r.finish()
+	if r.session.inflight.wasCancelled(r.ID) {
+		return
+	}
+	r.write(Response{JSONRPC: "2.0", ID: r.ID, Result: result})
+}
+
+// fail responde con un error JSON-RPC.
+func (r *request) fail(code int, message string, data interface{}) {
+	defer r.finish()
+	if r.session.inflight.wasCancelled(r.ID) {
+		return
+	}
+	r.write(errorResponse(r.ID, code, message, data))
+}
+
+// toolResult responde un tools/call con contenido de texto.
+func (r *request) toolResult(text string) {
+	r.respond(map[string]interface{}{
+		"content": []map[string]interface{}{
+			{"type": "text", "text": text},
+		},
+	})
+}
+
+// toolError responde un tools/call que se ejecutó pero falló. Según MCP
+// no es un error de protocolo: va como resultado con isError para que el
+// modelo vea el mensaje y pueda corregir la llamada.
+func (r *request) toolError(text string) {
+	r.respond(map[string]interface{}{
+		"content": []map[string]interface{}{
+			{"type": "text", "text": text},
+		},
+		"isError": true,
+	})
+}
+
+// toolStructured responde con el JSON como texto y, si la revisión
+// negociada lo incluye, también como structuredContent.
+func (r *request) toolStructured(v interface{}) {
+	text, _ := json.MarshalIndent(v, "", "  ")
+	result := map[string]interface{}{
+		"content": []map[string]interface{}{
+			{"type": "text", "text": string(text)},
+		},
+	}
+	if r.session.supports(featureStructuredContent) {
+		result["structuredContent"] = v
+	}
+	r.respond(result)
+}
+
+// notify envía una notificación ligada a esta solicitud (progress) por el
+// mismo destino que su respuesta.
+func (r *request) notify(method string, params interface{}) {
+	r.write(Notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// streamID identifica la solicitud en el stream del dashboard.
+func (r *request) streamID() string {
+	return fmt.Sprintf("%s/%v", r.session.ID[:8], r.ID)
+}
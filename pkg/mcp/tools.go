@@ -0,0 +1,533 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+	"github.com/andesdevroot/promptc/pkg/engine"
+	"github.com/andesdevroot/promptc/pkg/resilience"
+	"github.com/andesdevroot/promptc/pkg/sdk"
+)
+
+// --- TOOL HANDLERS ---
+
+func (s *Server) handleToolCall(ctx context.Context, req *request) {
+	var call struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+		Meta      struct {
+			ProgressToken interface{} `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(req.Params, &call); err != nil {
+		s.audit(AuditEvent{
+			Type:   "MCP",
+			Action: "TOOL_PARSE_ERROR",
+			Actor:  req.session.Client(),
+			Result: "FAIL",
+			Detail: err.Error(),
+		})
+		req.fail(CodeInvalidParams, "parámetros de tools/call inválidos", err.Error())
+		return
+	}
+	req.progressToken = call.Meta.ProgressToken
+
+	ctx, cancel := context.WithTimeout(ctx, s.toolTimeout(call.Name))
+	defer cancel()
+
+	// Evento MCP: el cliente invocó una herramienta
+	s.audit(AuditEvent{
+		Type:     "MCP",
+		Action:   "TOOL_INVOKED",
+		Actor:    req.session.Client(),
+		Resource: call.Name,
+		Result:   "OK",
+		Detail:   "Solicitud recibida vía MCP " + req.session.Transport,
+	})
+
+	tool, ok := s.tools.lookup(call.Name)
+	if !ok {
+		s.audit(AuditEvent{
+			Type:     "MCP",
+			Action:   "TOOL_NOT_FOUND",
+			Actor:    req.session.Client(),
+			Resource: call.Name,
+			Result:   "FAIL",
+			Detail:   "Herramienta no registrada en el servidor MCP",
+		})
+		req.fail(CodeInvalidParams, fmt.Sprintf("herramienta '%s' no registrada", call.Name), nil)
+		return
+	}
+	tool.call(ctx, req, call.Arguments)
+}
+
+type getTemplateArgs struct {
+	Name string `json:"template_name" required:"true" desc:"Nombre exacto de la plantilla registrada en templates.json"`
+}
+
+func (s *Server) toolGetTemplate(ctx context.Context, req *request, args getTemplateArgs) (string, error) {
+	if args.Name == "" {
+		return "", invalidParams("falta el argumento requerido template_name", nil)
+	}
+
+	tmpl, ok := s.templates.Template(args.Name)
+
+	if !ok {
+		s.audit(AuditEvent{
+			Type:     "TEMPLATE",
+			Action:   "GET_NOT_FOUND",
+			Actor:    "promptc-engine",
+			Resource: args.Name,
+			Result:   "FAIL",
+			Detail:   "Template no registrado en templates.json",
+		})
+		return "", fmt.Errorf("template '%s' no encontrado", args.Name)
+	}
+
+	s.metrics.RecordTemplateCall(args.Name)
+	s.audit(AuditEvent{
+		Type:     "TEMPLATE",
+		Action:   "GET_SERVED",
+		Actor:    "promptc-engine",
+		Resource: args.Name,
+		Result:   "OK",
+		Detail:   fmt.Sprintf("desc=%q content_len=%d", tmpl.Description, len(tmpl.Content)),
+	})
+	return tmpl.Content, nil
+}
+
+type optimizeArgs struct {
+	Role        string            `json:"role" required:"true" desc:"Rol del agente o sistema que ejecutará el prompt"`
+	Context     string            `json:"context" required:"true" desc:"Contexto de negocio o técnico relevante para el prompt"`
+	Task        string            `json:"task" desc:"Tarea concreta; con template_name resuelve {{task}}"`
+	Template    string            `json:"template_name" desc:"Nombre del template en templates.json para usar como base del Task con resolución automática de {{variables}}"`
+	Constraints []string          `json:"constraints" desc:"Restricciones opcionales"`
+	Variables   map[string]string `json:"variables" desc:"Variables de sustitución para resolver {{placeholders}} del template"`
+	Team        string            `json:"team" desc:"Equipo solicitante — selecciona su versión de la instrucción de optimización"`
+}
+
+func (s *Server) toolOptimizePrompt(ctx context.Context, req *request, args optimizeArgs) (string, error) {
+	app := s.app
+	if missing := missingOptimizeArgs(args.Role, args.Context, args.Task, args.Template); len(missing) > 0 {
+		return "", invalidParams("faltan argumentos requeridos", map[string]interface{}{"missing": missing})
+	}
+	if app == nil {
+		return "", fmt.Errorf("SDK no inicializado: sin optimizadores disponibles")
+	}
+
+	// Inyección de template como base del Task: el mismo prompt que
+	// armarían lint_prompt, compile_prompt y render_template
+	p, injected, err := s.promptFrom(promptToolArgs{
+		Role:        args.Role,
+		Context:     args.Context,
+		Task:        args.Task,
+		Template:    args.Template,
+		Constraints: args.Constraints,
+		Variables:   args.Variables,
+	})
+	if err != nil {
+		return "", err
+	}
+	if injected {
+		s.audit(AuditEvent{
+			Type:     "TEMPLATE",
+			Action:   "INJECT_AS_TASK",
+			Actor:    "promptc-engine",
+			Resource: args.Template,
+			Result:   "OK",
+			Detail:   fmt.Sprintf("Template inyectado como base — variables a resolver: %d", len(args.Variables)),
+		})
+	}
+
+	// Enrutamiento al nodo de inferencia
+	nodeOnline := s.metrics.NodeOnline()
+	inferenceActor := "mac-mini"
+	if !nodeOnline {
+		inferenceActor = "gemini-cloud"
+	}
+
+	team := args.Team
+	if team == "" {
+		team = s.defaultTeam
+	}
+	instVersion := app.Instructions.For(team).Version
+
+	s.audit(AuditEvent{
+		Type:     "INFERENCE",
+		Action:   "PIPELINE_START",
+		Actor:    "promptc-engine",
+		Resource: inferenceActor,
+		Result:   "OK",
+		Detail: fmt.Sprintf("role=%q constraints=%d variables=%d instruction=%s",
+			args.Role, len(args.Constraints), len(args.Variables), instVersion),
+	})
+
+	start := time.Now()
+	ctx = sdk.WithCaller(ctx, sdk.Caller{Team: team, Client: req.session.Account(), Template: args.Template})
+
+	// Streaming: cada chunk va al dashboard y, si el cliente mandó un
+	// progressToken, también como notifications/progress por MCP.
+	streamID := req.streamID()
+	s.onStream(StreamEvent{Kind: "start", ID: streamID, Resource: inferenceActor})
+	var streamed int
+	onChunk := func(chunk string) {
+		streamed += len(chunk)
+		if req.progressToken != nil && ctx.Err() == nil {
+			req.notify("notifications/progress", map[string]interface{}{
+				"progressToken": req.progressToken,
+				"progress":      streamed,
+				"message":       chunk,
+			})
+		}
+		s.onStream(StreamEvent{Kind: "token", ID: streamID, Chunk: chunk})
+	}
+
+	out, err := app.Run(ctx, p, onChunk)
+
+	latencyMs := time.Since(start).Milliseconds()
+	// Tokens reales del proveedor cuando hubo optimización; si se
+	// compiló sin modelo, el estimado de siempre sobre el texto final.
+	tokens := int64(len(out.Text) / 4)
+	model := "none"
+	if out.Optimized {
+		tokens = out.Provenance.InputTokens + out.Provenance.OutputTokens
+		model = out.Provenance.Model
+	}
+	cost := out.Cost
+	cacheResult := "MISS"
+	if out.Cached {
+		// Un hit no consumió tokens ni cuota
+		tokens = 0
+		cacheResult = "HIT"
+	}
+
+	if errors.Is(err, resilience.ErrBusy) {
+		// Rechazo por capacidad: no es una inferencia fallida y no afecta el success ratio
+		s.onStream(StreamEvent{Kind: "end", ID: streamID, Result: "BUSY"})
+		s.audit(AuditEvent{
+			Type:      "POLICY",
+			Action:    "PIPELINE_BUSY",
+			Actor:     "promptc-engine",
+			Resource:  "optimize_prompt",
+			Result:    "WARN",
+			LatencyMs: latencyMs,
+			Detail:    err.Error(),
+		})
+		return "", fmt.Errorf("PROMPTC ocupado, reintenta en unos segundos: %v", err)
+	}
+	if err != nil {
+		s.onStream(StreamEvent{Kind: "end", ID: streamID, Result: "FAIL"})
+		s.audit(AuditEvent{
+			Type:      "INFERENCE",
+			Action:    "PIPELINE_FAIL",
+			Actor:     inferenceActor,
+			Resource:  "optimize_prompt",
+			Result:    "FAIL",
+			LatencyMs: latencyMs,
+			Detail:    err.Error(),
+		})
+		s.recordInference(false, latencyMs, 0, !nodeOnline)
+		return "", fmt.Errorf("Error en pipeline de optimización: %v", err)
+	}
+
+	s.onStream(StreamEvent{Kind: "end", ID: streamID, Result: "OK"})
+	s.audit(AuditEvent{
+		Type:      "INFERENCE",
+		Action:    "PIPELINE_OK",
+		Actor:     inferenceActor,
+		Resource:  "optimize_prompt",
+		Result:    "OK",
+		LatencyMs: latencyMs,
+		Detail: fmt.Sprintf("tokens=%d model=%s cost=$%.5f soberanía=%s instruction=%s cache=%s", tokens, model, cost, func() string {
+			if nodeOnline {
+				return "LOCAL"
+			}
+			return "CLOUD"
+		}(), instVersion, cacheResult),
+	})
+	s.recordInference(true, latencyMs, tokens, !nodeOnline && !out.Cached)
+	return out.Text, nil
+}
+
+// missingOptimizeArgs lista los argumentos requeridos ausentes de
+// optimize_prompt. task no es requerido si se usa template_name.
+func missingOptimizeArgs(role, context, task, template string) []string {
+	var missing []string
+	if strings.TrimSpace(role) == "" {
+		missing = append(missing, "role")
+	}
+	if strings.TrimSpace(context) == "" {
+		missing = append(missing, "context")
+	}
+	if strings.TrimSpace(task) == "" && template == "" {
+		missing = append(missing, "task")
+	}
+	return missing
+}
+
+// --- HERRAMIENTAS DETERMINISTAS ---
+// lint_prompt, compile_prompt, list_templates y render_template nunca llaman
+// a un modelo: permiten al asistente revisar y armar un prompt antes de
+// gastar una inferencia con optimize_prompt.
+
+// promptToolArgs son los argumentos comunes a las herramientas que reciben
+// un prompt, con el mismo significado que en optimize_prompt.
+type promptToolArgs struct {
+	Role        string            `json:"role" desc:"Rol del agente o sistema que ejecutará el prompt"`
+	Context     string            `json:"context" desc:"Contexto de negocio o técnico relevante para el prompt"`
+	Task        string            `json:"task" desc:"Tarea concreta; con template_name resuelve {{task}}"`
+	Template    string            `json:"template_name" desc:"Template de templates.json a usar como base del Task"`
+	Constraints []string          `json:"constraints" desc:"Restricciones opcionales"`
+	Variables   map[string]string `json:"variables" desc:"Variables de sustitución para resolver {{placeholders}}"`
+}
+
+// missingTask marca el {{task}} de un template cuando no viene task: igual
+// que los demás placeholders sin valor en ResolveVariables.
+const missingTask = "[MISSING:task]"
+
+// promptFrom arma el core.Prompt de optimize_prompt y de las herramientas
+// deterministas. Con template_name el contenido del template reemplaza al
+// Task y el task del argumento resuelve su {{task}}; sin task el placeholder
+// queda marcado como faltante en vez de resolverse con el propio template.
+// Un template desconocido se audita como WARN y se usa el task del
+// argumento. injected indica si se usó el template.
+func (s *Server) promptFrom(a promptToolArgs) (p core.Prompt, injected bool, err error) {
+	p = core.Prompt{
+		Role:        a.Role,
+		Context:     a.Context,
+		Task:        a.Task,
+		Constraints: a.Constraints,
+		Variables:   a.Variables,
+	}
+	if a.Template == "" {
+		return p, false, nil
+	}
+	tmpl, ok := s.templates.Template(a.Template)
+	if !ok {
+		s.audit(AuditEvent{
+			Type:     "TEMPLATE",
+			Action:   "INJECT_NOT_FOUND",
+			Actor:    "promptc-engine",
+			Resource: a.Template,
+			Result:   "WARN",
+			Detail:   "Template no encontrado — usando Task directo del argumento",
+		})
+		if strings.TrimSpace(a.Task) == "" {
+			return p, false, fmt.Errorf("template '%s' no encontrado y sin task para usar en su lugar", a.Template)
+		}
+		return p, false, nil
+	}
+	task := a.Task
+	if strings.TrimSpace(task) == "" {
+		task = missingTask
+	}
+	p.Task = strings.ReplaceAll(tmpl.Content, "{{task}}", task)
+	s.metrics.RecordTemplateCall(a.Template)
+	return p, true, nil
+}
+
+// recordInference actualiza las métricas y avisa a los suscriptores de
+// promptc://metrics.
+func (s *Server) recordInference(success bool, latencyMs, tokens int64, usedCloud bool) {
+	s.metrics.RecordInference(success, latencyMs, tokens, usedCloud)
+	s.notifyResourceUpdated(metricsURI)
+}
+
+func (s *Server) engine() *engine.CompilerEngine {
+	if s.app != nil && s.app.Engine != nil {
+		return s.app.Engine
+	}
+	return engine.New()
+}
+
+type lintResult struct {
+	Score               int      `json:"score" desc:"Score de calidad, 0 a 100"`
+	IsReliable          bool     `json:"is_reliable" desc:"true si el prompt se puede compilar sin optimizar"`
+	Issues              []string `json:"issues"`
+	Suggestions         []string `json:"suggestions"`
+	UnresolvedVariables []string `json:"unresolved_variables" desc:"{{placeholders}} sin valor en variables"`
+}
+
+func (s *Server) toolLintPrompt(ctx context.Context, req *request, args promptToolArgs) (lintResult, error) {
+	p, _, err := s.promptFrom(args)
+	if err != nil {
+		return lintResult{}, err
+	}
+	eng := s.engine()
+	res := eng.Analyze(p)
+	missing := engine.Placeholders(p.Task)
+	unresolved := []string{}
+	for _, name := range missing {
+		if _, ok := p.Variables[name]; !ok && !coreField(name) {
+			unresolved = append(unresolved, name)
+		}
+	}
+	if strings.Contains(p.Task, missingTask) {
+		unresolved = append(unresolved, "task")
+	}
+
+	s.audit(AuditEvent{
+		Type:     "POLICY",
+		Action:   "LINT",
+		Actor:    "promptc-engine",
+		Resource: "lint_prompt",
+		Result:   "OK",
+		Detail:   fmt.Sprintf("score=%d reliable=%v issues=%d", res.Score, res.IsReliable, len(res.Issues)),
+	})
+	return lintResult{
+		Score:               res.Score,
+		IsReliable:          res.IsReliable,
+		Issues:              nonNil(res.Issues),
+		Suggestions:         nonNil(res.Suggestions),
+		UnresolvedVariables: unresolved,
+	}, nil
+}
+
+type compileResult struct {
+	Prompt     string `json:"prompt" desc:"Prompt compilado en Markdown"`
+	Score      int    `json:"score"`
+	IsReliable bool   `json:"is_reliable"`
+}
+
+func (s *Server) toolCompilePrompt(ctx context.Context, req *request, args promptToolArgs) (compileResult, error) {
+	if missing := missingOptimizeArgs(args.Role, args.Context, args.Task, args.Template); len(missing) > 0 {
+		return compileResult{}, invalidParams("faltan argumentos requeridos", map[string]interface{}{"missing": missing})
+	}
+	p, _, err := s.promptFrom(args)
+	if err != nil {
+		return compileResult{}, err
+	}
+	eng := s.engine()
+	compiled, err := eng.Compile(p)
+	if err != nil {
+		return compileResult{}, fmt.Errorf("Error compilando: %v", err)
+	}
+	res := eng.Analyze(p)
+
+	s.audit(AuditEvent{
+		Type:     "POLICY",
+		Action:   "COMPILE_DETERMINISTIC",
+		Actor:    "promptc-engine",
+		Resource: "compile_prompt",
+		Result:   "OK",
+		Detail:   fmt.Sprintf("score=%d len=%d", res.Score, len(compiled)),
+	})
+	return compileResult{Prompt: compiled, Score: res.Score, IsReliable: res.IsReliable}, nil
+}
+
+type templateSummary struct {
+	Name              string   `json:"name"`
+	Description       string   `json:"description"`
+	RequiredVariables []string `json:"required_variables"`
+	OptionalVariables []string `json:"optional_variables"`
+}
+
+type listTemplatesResult struct {
+	Templates []templateSummary `json:"templates"`
+}
+
+func (s *Server) toolListTemplates(ctx context.Context, req *request, _ struct{}) (listTemplatesResult, error) {
+	all := s.templates.Templates()
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	templates := make([]templateSummary, 0, len(names))
+	for _, name := range names {
+		tmpl := all[name]
+		summary := templateSummary{
+			Name:              name,
+			Description:       tmpl.Description,
+			RequiredVariables: []string{},
+			OptionalVariables: []string{},
+		}
+		for _, arg := range templateArguments(tmpl.Content) {
+			if arg.Required {
+				summary.RequiredVariables = append(summary.RequiredVariables, arg.Name)
+			} else {
+				summary.OptionalVariables = append(summary.OptionalVariables, arg.Name)
+			}
+		}
+		templates = append(templates, summary)
+	}
+
+	return listTemplatesResult{Templates: templates}, nil
+}
+
+type renderResult struct {
+	Template         string   `json:"template"`
+	Text             string   `json:"text" desc:"Template con las variables resueltas"`
+	MissingVariables []string `json:"missing_variables"`
+}
+
+func (s *Server) toolRenderTemplate(ctx context.Context, req *request, args promptToolArgs) (renderResult, error) {
+	if args.Template == "" {
+		return renderResult{}, invalidParams("falta el argumento requerido template_name", nil)
+	}
+	// Sin template no hay nada que renderizar: aquí no aplica el fallback al task
+	if _, ok := s.templates.Template(args.Template); !ok {
+		return renderResult{}, fmt.Errorf("template '%s' no encontrado", args.Template)
+	}
+	p, _, err := s.promptFrom(args)
+	if err != nil {
+		return renderResult{}, err
+	}
+	rendered := s.engine().ResolveVariables(p.Task, p)
+	missing := []string{}
+	for _, marker := range engine.Placeholders(p.Task) {
+		if _, ok := p.Variables[marker]; !ok && !coreFieldSet(marker, p) {
+			missing = append(missing, marker)
+		}
+	}
+	if strings.Contains(p.Task, missingTask) {
+		missing = append(missing, "task")
+	}
+
+	s.audit(AuditEvent{
+		Type:     "TEMPLATE",
+		Action:   "RENDERED",
+		Actor:    "promptc-engine",
+		Resource: args.Template,
+		Result:   "OK",
+		Detail:   fmt.Sprintf("variables=%d faltantes=%d", len(args.Variables), len(missing)),
+	})
+	return renderResult{Template: args.Template, Text: rendered, MissingVariables: missing}, nil
+}
+
+// coreField indica los placeholders que ResolveVariables llena desde los
+// campos del prompt y no desde Variables.
+func coreField(name string) bool {
+	switch name {
+	case "role", "context", "task", "constraints":
+		return true
+	}
+	return false
+}
+
+// coreFieldSet indica si un placeholder core tiene valor en el prompt.
+// constraints es opcional: vacío también es un valor válido.
+func coreFieldSet(name string, p core.Prompt) bool {
+	switch name {
+	case "role":
+		return p.Role != ""
+	case "context":
+		return p.Context != ""
+	case "constraints":
+		return true
+	}
+	return false
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+	"gopkg.in/yaml.v3"
+)
+
+// Update reescribe role, context, task y constraints de p dentro del
+// documento YAML data. Se edita el árbol de nodos y no la estructura: los
+// comentarios, el orden de las claves y los campos que p no toca (id,
+// version, variables) se conservan. Los valores que no cambian conservan
+// también su estilo de comillas.
+func Update(data []byte, p core.Prompt) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error de sintaxis en el YAML: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("el documento no es un mapa de claves (role, context, task...)")
+	}
+	root := doc.Content[0]
+
+	setScalar(root, "role", p.Role)
+	setScalar(root, "context", p.Context)
+	setScalar(root, "task", p.Task)
+	setSequence(root, "constraints", p.Constraints)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(indentOf(data))
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// lookup retorna el nodo valor de key, o lo agrega al final del mapa.
+func lookup(m *yaml.Node, key string, kind yaml.Kind) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	k := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	v := &yaml.Node{Kind: kind}
+	m.Content = append(m.Content, k, v)
+	return v
+}
+
+func setScalar(m *yaml.Node, key, value string) {
+	n := lookup(m, key, yaml.ScalarNode)
+	if n.Kind == yaml.ScalarNode && n.Value == value {
+		return
+	}
+	fillScalar(n, value)
+}
+
+// fillScalar reemplaza el valor de n conservando sus comentarios. El texto
+// multilínea se escribe como bloque literal (|); el resto conserva el estilo
+// de comillas que tenía, salvo que fuera un bloque.
+func fillScalar(n *yaml.Node, value string) {
+	style := n.Style
+	if n.Kind != yaml.ScalarNode {
+		style = 0
+	}
+	switch {
+	case strings.Contains(value, "\n"):
+		style = yaml.LiteralStyle
+	case style == yaml.LiteralStyle || style == yaml.FoldedStyle:
+		style = 0
+	}
+	n.Kind, n.Tag, n.Value, n.Style, n.Content = yaml.ScalarNode, "!!str", value, style, nil
+}
+
+func setSequence(m *yaml.Node, key string, values []string) {
+	n := lookup(m, key, yaml.SequenceNode)
+	if n.Kind == yaml.SequenceNode {
+		current := make([]string, 0, len(n.Content))
+		for _, item := range n.Content {
+			current = append(current, item.Value)
+		}
+		if slices.Equal(current, values) {
+			return
+		}
+	} else {
+		n.Kind, n.Tag, n.Value, n.Style, n.Content = yaml.SequenceNode, "!!seq", "", 0, nil
+	}
+
+	// Los elementos existentes se reutilizan con sus comentarios y estilo:
+	// primero el que tiene el mismo valor, para que un comentario siga a su
+	// restricción aunque el modelo inserte o reordene; si no hay, el de la
+	// misma posición que ya no se usa (una restricción reescrita). Los
+	// nuevos copian el estilo del primero.
+	var itemStyle yaml.Style
+	if len(n.Content) > 0 {
+		itemStyle = n.Content[0].Style
+	}
+	used := make([]bool, len(n.Content))
+	items := make([]*yaml.Node, len(values))
+	for i, v := range values {
+		for j, item := range n.Content {
+			if !used[j] && item.Kind == yaml.ScalarNode && item.Value == v {
+				items[i], used[j] = item, true
+				break
+			}
+		}
+	}
+	for i, v := range values {
+		if items[i] != nil {
+			continue
+		}
+		item := &yaml.Node{Kind: yaml.ScalarNode, Style: itemStyle}
+		if i < len(n.Content) && !used[i] {
+			item, used[i] = n.Content[i], true
+		}
+		fillScalar(item, v)
+		items[i] = item
+	}
+	n.Content = items
+}
+
+// indentOf detecta la sangría del documento: la menor sangría de una línea
+// con contenido. yaml.v3 usa 4 por defecto y la mayoría de los prompts 2.
+func indentOf(data []byte) int {
+	indent := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if n := len(line) - len(trimmed); n > 0 && (indent == 0 || n < indent) {
+			indent = n
+		}
+	}
+	if indent < 2 {
+		return 2
+	}
+	return indent
+}
@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+)
+
+const source = `# Prompt de ventas
+id: ventas
+version: "1"
+role: 'Analista'
+context: corto # se completa después
+task: haz algo
+constraints:
+  # idioma del informe
+  - Responde en español
+  # formato
+  - Usa una tabla
+variables:
+  region: sur
+`
+
+func TestUpdateKeepsComments(t *testing.T) {
+	p := core.Prompt{
+		Role:    "Analista comercial senior",
+		Context: "Datos de venta 2024 por región",
+		Task:    "Identifica las tres regiones con mayor caída",
+		// El modelo inserta una restricción al inicio y reordena las demás
+		Constraints: []string{"No inventes cifras", "Usa una tabla", "Responde en español"},
+	}
+	out, err := Update([]byte(source), p)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got := string(out)
+	for _, want := range []string{
+		"# Prompt de ventas",
+		"id: ventas",
+		`version: "1"`,
+		"role: 'Analista comercial senior'",
+		"context: Datos de venta 2024 por región # se completa después",
+		"  region: sur",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("falta %q en:\n%s", want, got)
+		}
+	}
+	// Cada comentario sigue a su restricción, no a la posición que ocupaba
+	for _, pair := range [][2]string{
+		{"# idioma del informe", "- Responde en español"},
+		{"# formato", "- Usa una tabla"},
+	} {
+		if !strings.Contains(got, pair[0]+"\n  "+pair[1]) {
+			t.Errorf("%q no quedó sobre %q:\n%s", pair[0], pair[1], got)
+		}
+	}
+	if strings.Contains(got, "# idioma del informe\n  - No inventes cifras") || strings.Contains(got, "# formato\n  - No inventes cifras") {
+		t.Errorf("la restricción nueva heredó un comentario:\n%s", got)
+	}
+
+	parsed, err := Parse(out)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if parsed.ID != "ventas" || parsed.Variables["region"] != "sur" || len(parsed.Constraints) != 3 {
+		t.Errorf("prompt = %+v", parsed)
+	}
+}
+
+func TestUpdateRewrittenConstraintKeepsComment(t *testing.T) {
+	p := core.Prompt{
+		Role:        "Analista",
+		Context:     "corto",
+		Task:        "haz algo",
+		Constraints: []string{"Responde siempre en español neutro", "Usa una tabla"},
+	}
+	out, err := Update([]byte(source), p)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if !strings.Contains(string(out), "# idioma del informe\n  - Responde siempre en español neutro") {
+		t.Errorf("la restricción reescrita perdió su comentario:\n%s", out)
+	}
+}
+
+func TestUpdateUnchangedIsIdentity(t *testing.T) {
+	p, err := Parse([]byte(source))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	out, err := Update([]byte(source), p)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if string(out) != source {
+		t.Errorf("sin cambios el documento debe quedar igual:\n%s", out)
+	}
+}
@@ -19,9 +19,14 @@ func LoadPrompt(filename string) (core.Prompt, error) {
 	}
 
 	// 2. Deserializar (Unmarshal) el YAML a la estructura de Go
+	return Parse(data)
+}
+
+// Parse convierte un documento YAML en core.Prompt.
+func Parse(data []byte) (core.Prompt, error) {
+	var p core.Prompt
 	if err := yaml.Unmarshal(data, &p); err != nil {
 		return p, fmt.Errorf("error de sintaxis en el YAML: %w", err)
 	}
-
 	return p, nil
 }
@@ -3,113 +3,360 @@ package provider
 import (
 	"context"
 	"fmt"
+	"log"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/andesdevroot/promptc/pkg/core"
 	"github.com/google/generative-ai-go/genai"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// DefaultGeminiModels es el orden de preferencia cuando la configuración no
+// define modelos. Si un modelo fue retirado (NotFound) se pasa al siguiente.
+var DefaultGeminiModels = []string{"gemini-2.5-flash", "gemini-2.5-pro", "gemini-2.0-flash"}
+
+// GeminiConfig agrupa lo configurable del proveedor Gemini. Construir el
+// proveedor no requiere red: los modelos se validan recién en la primera
+// llamada, y solo si Discover está activo.
+type GeminiConfig struct {
+	APIKey            string            `yaml:"-"`
+	Models            []string          `yaml:"models,omitempty"`   // orden de preferencia y de fallback
+	Discover          bool              `yaml:"discover,omitempty"` // contrastar Models con ListModels en la primera llamada
+	Temperature       *float32          `yaml:"temperature,omitempty"`
+	MaxOutputTokens   int32             `yaml:"max_output_tokens,omitempty"`
+	SystemInstruction string            `yaml:"system_instruction,omitempty"` // reemplaza el system de la instrucción compartida
+	PlainText         bool              `yaml:"plain_text,omitempty"`         // desactiva el modo JSON nativo en modelos que no lo soportan
+	Safety            map[string]string `yaml:"safety,omitempty"`             // categoría -> umbral, ej: harassment: block_only_high
+}
+
+// DefaultGeminiConfig retorna la configuración base para una API key.
+func DefaultGeminiConfig(apiKey string) GeminiConfig {
+	return GeminiConfig{APIKey: apiKey}
+}
+
+var geminiSafetyCategories = map[string]genai.HarmCategory{
+	"harassment":        genai.HarmCategoryHarassment,
+	"hate_speech":       genai.HarmCategoryHateSpeech,
+	"sexually_explicit": genai.HarmCategorySexuallyExplicit,
+	"dangerous_content": genai.HarmCategoryDangerousContent,
+}
+
+var geminiSafetyThresholds = map[string]genai.HarmBlockThreshold{
+	"block_none":             genai.HarmBlockNone,
+	"block_only_high":        genai.HarmBlockOnlyHigh,
+	"block_medium_and_above": genai.HarmBlockMediumAndAbove,
+	"block_low_and_above":    genai.HarmBlockLowAndAbove,
+}
+
 type GeminiProvider struct {
-	client      *genai.Client
-	activeModel string
+	client *genai.Client
+	cfg    GeminiConfig
+	safety []*genai.SafetySetting
+
+	mu         sync.Mutex
+	models     []string // orden efectivo de fallback
+	active     int      // índice del modelo en uso dentro de models
+	discovered bool
 }
 
-func NewGeminiProvider(ctx context.Context, apiKey string) (*GeminiProvider, error) {
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		return nil, fmt.Errorf("error al inicializar cliente genai: %w", err)
+func NewGeminiProvider(ctx context.Context, cfg GeminiConfig) (*GeminiProvider, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("gemini: api key vacía")
+	}
+	models := cfg.Models
+	if len(models) == 0 {
+		models = DefaultGeminiModels
 	}
 
-	provider := &GeminiProvider{client: client}
-	err = provider.discoverBestModel(ctx)
+	safety, err := buildSafetySettings(cfg.Safety)
 	if err != nil {
 		return nil, err
 	}
 
-	return provider, nil
+	// genai.NewClient no abre conexión: el dial gRPC ocurre en la primera llamada
+	client, err := genai.NewClient(ctx, option.WithAPIKey(cfg.APIKey))
+	if err != nil {
+		return nil, fmt.Errorf("error al inicializar cliente genai: %w", err)
+	}
+
+	return &GeminiProvider{
+		client: client,
+		cfg:    cfg,
+		safety: safety,
+		models: append([]string(nil), models...),
+	}, nil
 }
 
-func (g *GeminiProvider) discoverBestModel(ctx context.Context) error {
-	iter := g.client.ListModels(ctx)
+func buildSafetySettings(cfg map[string]string) ([]*genai.SafetySetting, error) {
+	// Orden estable para que el request sea reproducible
+	names := make([]string, 0, len(cfg))
+	for name := range cfg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-	// Prioridad: 1.5 Flash (estable), 1.5 Pro (estable), luego el resto.
-	// PRAGMATISMO: Evitamos modelos '-exp' que reportan quota limit 0.
-	available := make(map[string]bool)
+	var out []*genai.SafetySetting
+	for _, name := range names {
+		category, ok := geminiSafetyCategories[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("gemini: categoría de seguridad desconocida %q", name)
+		}
+		threshold, ok := geminiSafetyThresholds[strings.ToLower(cfg[name])]
+		if !ok {
+			return nil, fmt.Errorf("gemini: umbral de seguridad desconocido %q para %s", cfg[name], name)
+		}
+		out = append(out, &genai.SafetySetting{Category: category, Threshold: threshold})
+	}
+	return out, nil
+}
+
+// discoverModels reordena los modelos según lo que la API reporta como
+// disponible. Corre una sola vez; si ListModels falla se mantiene el orden
+// configurado, que sigue siendo válido gracias al fallback por NotFound.
+func (g *GeminiProvider) discoverModels(ctx context.Context) {
+	g.mu.Lock()
+	if !g.cfg.Discover || g.discovered {
+		g.mu.Unlock()
+		return
+	}
+	g.discovered = true
+	g.mu.Unlock()
 
+	available := make(map[string]bool)
+	iter := g.client.ListModels(ctx)
 	for {
 		m, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			return err
+			log.Printf("[GEMINI] ListModels falló, se usa el orden configurado: %v", err)
+			return
 		}
-
 		name := strings.TrimPrefix(m.Name, "models/")
-
-		// Filtro: Solo modelos que soporten generación y NO sean experimentales
-		supportsGenerate := false
+		// PRAGMATISMO: Evitamos modelos '-exp' que reportan quota limit 0.
+		if strings.Contains(name, "-exp") {
+			continue
+		}
 		for _, op := range m.SupportedGenerationMethods {
 			if op == "generateContent" {
-				supportsGenerate = true
+				available[name] = true
 				break
 			}
 		}
+	}
 
-		if supportsGenerate && !strings.Contains(name, "-exp") {
-			available[name] = true
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var ordered []string
+	for _, name := range g.models {
+		if available[name] {
+			ordered = append(ordered, name)
 		}
 	}
-
-	// Selección por ranking de estabilidad
-	ranking := []string{"gemini-1.5-flash", "gemini-1.5-pro", "gemini-1.0-pro"}
-	for _, r := range ranking {
-		if available[r] {
-			g.activeModel = r
-			return nil
+	if len(ordered) == 0 {
+		// Ninguno de los configurados existe: orden alfabético para que sea determinista
+		for name := range available {
+			ordered = append(ordered, name)
 		}
+		sort.Strings(ordered)
 	}
+	if len(ordered) > 0 {
+		g.models = ordered
+		g.active = 0
+	}
+}
 
-	// Fallback a cualquier modelo no experimental
-	for name := range available {
-		g.activeModel = name
-		return nil
+func (g *GeminiProvider) activeModel() (string, int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.models[g.active], g.active
+}
+
+// retireModel avanza al siguiente modelo de la lista cuando el actual ya no existe.
+func (g *GeminiProvider) retireModel(idx int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.active != idx {
+		// Otra llamada concurrente ya avanzó
+		return true
+	}
+	if g.active+1 >= len(g.models) {
+		return false
 	}
+	log.Printf("[GEMINI] Modelo %s no disponible, usando %s", g.models[g.active], g.models[g.active+1])
+	g.active++
+	return true
+}
 
-	return fmt.Errorf("no se encontraron modelos estables con cuota disponible")
+func (g *GeminiProvider) model(name string) *genai.GenerativeModel {
+	model := g.client.GenerativeModel(name)
+	if g.cfg.Temperature != nil {
+		model.SetTemperature(*g.cfg.Temperature)
+	} else {
+		model.SetTemperature(0.2)
+	}
+	if g.cfg.MaxOutputTokens > 0 {
+		model.SetMaxOutputTokens(g.cfg.MaxOutputTokens)
+	}
+	if g.cfg.SystemInstruction != "" {
+		model.SystemInstruction = &genai.Content{Parts: []genai.Part{genai.Text(g.cfg.SystemInstruction)}}
+	}
+	if !g.cfg.PlainText {
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = geminiPromptSchema
+	}
+	model.SafetySettings = g.safety
+	return model
 }
 
+// Name es estable aunque un modelo se retire: identifica al proveedor en el
+// breaker, la caché y los reportes de carrera. El modelo va en ModelName y
+// en la procedencia.
 func (g *GeminiProvider) Name() string {
-	if g.activeModel != "" {
-		return fmt.Sprintf("Google Gemini (%s)", g.activeModel)
-	}
 	return "Google Gemini"
 }
 
-func (g *GeminiProvider) Optimize(ctx context.Context, p core.Prompt, issues []string) (string, error) {
-	model := g.client.GenerativeModel(g.activeModel)
-	model.SetTemperature(0.2)
+// ModelName retorna el modelo activo; cambia si uno se retira con NotFound.
+func (g *GeminiProvider) ModelName() string {
+	name, _ := g.activeModel()
+	return name
+}
+
+func (g *GeminiProvider) Optimize(ctx context.Context, inst core.Instruction) (core.Optimization, error) {
+	return g.OptimizeStream(ctx, inst, nil)
+}
 
-	var sb strings.Builder
-	sb.WriteString("Optimiza este prompt profesionalmente en Español:\n")
-	sb.WriteString(fmt.Sprintf("ROLE: %s\nTASK: %s\n", p.Role, p.Task))
-	sb.WriteString("Usa headers ### ROLE, ### CONTEXT, ### TASK, ### CONSTRAINTS.")
+// OptimizeStream usa el iterador de streaming de genai para entregar cada
+// fragmento de la respuesta a onChunk en cuanto Gemini lo emite.
+func (g *GeminiProvider) OptimizeStream(ctx context.Context, inst core.Instruction, onChunk core.ChunkHandler) (core.Optimization, error) {
+	return g.stream(ctx, inst, onChunk, true)
+}
 
-	resp, err := model.GenerateContent(ctx, genai.Text(sb.String()))
-	if err != nil {
-		// Retornamos el error original para que el SDK decida qué hacer
-		return "", err
+// stream recorre los modelos con fallback por NotFound. override indica si
+// gemini.system_instruction reemplaza el system de la instrucción.
+func (g *GeminiProvider) stream(ctx context.Context, inst core.Instruction, onChunk core.ChunkHandler, override bool) (core.Optimization, error) {
+	g.discoverModels(ctx)
+
+	for {
+		name, idx := g.activeModel()
+		out, err := g.generate(ctx, name, inst, onChunk, override)
+		// Un modelo retirado responde NotFound antes de emitir chunks
+		if status.Code(err) == codes.NotFound {
+			if g.retireModel(idx) {
+				continue
+			}
+			return out, classifyGeminiError(err)
+		}
+		return out, err
 	}
+}
+
+func (g *GeminiProvider) generate(ctx context.Context, modelName string, inst core.Instruction, onChunk core.ChunkHandler, override bool) (core.Optimization, error) {
+	var out core.Optimization
+	start := time.Now()
 
-	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
-		return "", fmt.Errorf("respuesta vacía de la IA")
+	model := g.model(modelName)
+	if (model.SystemInstruction == nil || !override) && inst.System != "" {
+		model.SystemInstruction = &genai.Content{Parts: []genai.Part{genai.Text(inst.System)}}
 	}
+	iter := model.GenerateContentStream(ctx, genai.Text(inst.User))
 
 	var res strings.Builder
-	for _, part := range resp.Candidates[0].Content.Parts {
-		res.WriteString(fmt.Sprint(part))
+	var usage *genai.UsageMetadata
+	for {
+		resp, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return out, err
+			}
+			// Clasificamos el error para que la capa de resiliencia decida si reintentar
+			return out, classifyGeminiError(err)
+		}
+		if resp.UsageMetadata != nil {
+			usage = resp.UsageMetadata
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			continue
+		}
+		for _, part := range resp.Candidates[0].Content.Parts {
+			chunk := fmt.Sprint(part)
+			res.WriteString(chunk)
+			if onChunk != nil {
+				onChunk(chunk)
+			}
+		}
+	}
+
+	if res.Len() == 0 {
+		return out, fmt.Errorf("respuesta vacía de la IA")
+	}
+
+	var err error
+	out.Raw = strings.TrimSpace(res.String())
+	out.Prompt, err = decodePrompt(out.Raw)
+	if err != nil {
+		return out, &core.ProviderError{Provider: "gemini", Err: err}
+	}
+	out.Provenance = core.Provenance{
+		Provider:    g.Name(),
+		Model:       modelName,
+		LatencyMs:   time.Since(start).Milliseconds(),
+		Instruction: inst.Version,
+	}
+	if usage != nil {
+		out.Provenance.InputTokens = int64(usage.PromptTokenCount)
+		out.Provenance.OutputTokens = int64(usage.CandidatesTokenCount)
+	} else {
+		out.Provenance.InputTokens = estimateTokens(inst.System + inst.User)
+		out.Provenance.OutputTokens = estimateTokens(out.Raw)
+	}
+	return out, nil
+}
+
+// geminiPromptSchema es el equivalente genai de promptSchema.
+var geminiPromptSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"role":        {Type: genai.TypeString},
+		"context":     {Type: genai.TypeString},
+		"task":        {Type: genai.TypeString},
+		"constraints": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+	},
+	Required: []string{"role", "context", "task", "constraints"},
+}
+
+// classifyGeminiError traduce los códigos gRPC de la API de Gemini a un
+// core.ProviderError. ResourceExhausted es el 429 de cuota agotada; una key
+// inválida llega como InvalidArgument y se informa como 401.
+func classifyGeminiError(err error) error {
+	switch status.Code(err) {
+	case codes.Unauthenticated:
+		return &core.ProviderError{Provider: "gemini", StatusCode: 401, Err: err}
+	case codes.PermissionDenied:
+		return &core.ProviderError{Provider: "gemini", StatusCode: 403, Err: err}
+	case codes.InvalidArgument:
+		if strings.Contains(status.Convert(err).Message(), "API key") {
+			return &core.ProviderError{Provider: "gemini", StatusCode: 401, Err: err}
+		}
+		return &core.ProviderError{Provider: "gemini", Retryable: false, Err: err}
+	case codes.ResourceExhausted:
+		return &core.ProviderError{Provider: "gemini", StatusCode: 429, Retryable: true, Err: err}
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Aborted:
+		return &core.ProviderError{Provider: "gemini", Retryable: true, Err: err}
+	case codes.Unknown:
+		// Errores de transporte sin status gRPC: los clasifica core.IsRetryable
+		return err
+	default:
+		return &core.ProviderError{Provider: "gemini", Retryable: false, Err: err}
 	}
-	return res.String(), nil
 }
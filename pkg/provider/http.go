@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+)
+
+// statusError convierte una respuesta HTTP no exitosa en un core.ProviderError.
+// 429 y 5xx se marcan como reintentables; el resto (401, 400, 404) es fatal.
+func statusError(provider string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		msg = http.StatusText(resp.StatusCode)
+	}
+
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return &core.ProviderError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Retryable:  retryable,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Err:        fmt.Errorf("%s", msg),
+	}
+}
+
+// parseRetryAfter acepta tanto segundos como fecha HTTP.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -15,48 +16,66 @@ import (
 type OllamaProvider struct {
 	BaseURL string
 	Model   string
+	APIKey  string
 	Client  *http.Client
 }
 
+// OllamaConfig ubica el nodo Ollama. Los campos vacíos usan el puerto
+// 11434, el modelo llama3 y un plazo de 60s.
+type OllamaConfig struct {
+	Host    string
+	Port    int
+	Model   string
+	Timeout time.Duration
+	APIKey  string // Bearer para un nodo detrás de un proxy con autenticación
+}
+
 func NewOllamaProvider(ip string) *OllamaProvider {
+	return NewOllamaProviderWith(OllamaConfig{Host: ip})
+}
+
+// NewOllamaProviderWith construye el proveedor desde una OllamaConfig.
+func NewOllamaProviderWith(cfg OllamaConfig) *OllamaProvider {
+	if cfg.Port == 0 {
+		cfg.Port = 11434
+	}
+	if cfg.Model == "" {
+		cfg.Model = "llama3"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 60 * time.Second
+	}
 	return &OllamaProvider{
-		BaseURL: fmt.Sprintf("http://%s:11434/api/generate", ip),
-		Model:   "llama3",
+		BaseURL: fmt.Sprintf("http://%s:%d/api/generate", cfg.Host, cfg.Port),
+		Model:   cfg.Model,
+		APIKey:  cfg.APIKey,
 		Client: &http.Client{
-			Timeout: 60 * time.Second,
+			Timeout: cfg.Timeout,
 		},
 	}
 }
 
 func (o *OllamaProvider) Name() string { return "Ollama Remote Node (Mac mini)" }
 
-func (o *OllamaProvider) Optimize(ctx context.Context, p core.Prompt, issues []string) (string, error) {
-	// Definimos el comportamiento esperado con un ejemplo claro (Few-Shot)
-	// Esto obliga al modelo a seguir el patrón de idioma y formato.
-	instruction := fmt.Sprintf(`Eres un Compilador de Prompts Técnico. Tu salida debe ser exclusivamente el prompt final optimizado.
-
-### REGLAS DE ORO:
-1. IDIOMA: Escribe TODO en ESPAÑOL DE CHILE/TÉCNICO.
-2. PROHIBICIÓN: No hables con el usuario. No digas "Aquí está tu prompt". No uses inglés.
-3. FORMATO: Devuelve un System Prompt estructurado.
-
-### EJEMPLO DE COMPILACIÓN:
-INPUT: {Role: "Dev", Context: "Web", Task: "Fix bug"}
-OUTPUT: Actúa como un Desarrollador Senior. Tu contexto es un entorno web moderno. Tu tarea es identificar y corregir errores de lógica de forma eficiente.
+func (o *OllamaProvider) ModelName() string { return o.Model }
 
-### TAREA REAL A COMPILAR:
-ROL: %s
-CONTEXTO: %s
-TAREA: %s
-ERRORES A CORREGIR: %s
+func (o *OllamaProvider) Optimize(ctx context.Context, inst core.Instruction) (core.Optimization, error) {
+	return o.OptimizeStream(ctx, inst, nil)
+}
 
-OUTPUT OPTIMIZADO EN ESPAÑOL:`, 
-		p.Role, p.Context, p.Task, strings.Join(issues, ", "))
+// OptimizeStream pide a Ollama la respuesta en modo stream (NDJSON) y entrega
+// cada token a onChunk apenas llega por el enlace Tailscale. El campo
+// `format` restringe la salida al JSON Schema del prompt estructurado.
+func (o *OllamaProvider) OptimizeStream(ctx context.Context, inst core.Instruction, onChunk core.ChunkHandler) (core.Optimization, error) {
+	var out core.Optimization
+	start := time.Now()
 
 	payload := map[string]interface{}{
 		"model":  o.Model,
-		"prompt": instruction,
-		"stream": false,
+		"system": inst.System,
+		"prompt": inst.User,
+		"format": promptSchema,
+		"stream": true,
 		"options": map[string]interface{}{
 			"temperature": 0.3, // Bajamos la temperatura para que sea más determinista y menos "creativo" (evita alucinaciones de idioma)
 		},
@@ -65,27 +84,73 @@ OUTPUT OPTIMIZADO EN ESPAÑOL:`,
 	jsonData, _ := json.Marshal(payload)
 	req, err := http.NewRequestWithContext(ctx, "POST", o.BaseURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", err
+		return out, err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
 
 	resp, err := o.Client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error en enlace Tailscale: %w", err)
+		return out, fmt.Errorf("error en enlace Tailscale: %w", err)
 	}
 	defer resp.Body.Close()
 
-	var result struct {
-		Response string `json:"response"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	if resp.StatusCode != http.StatusOK {
+		return out, statusError("ollama", resp)
 	}
 
-	// Limpieza final por si el modelo ignora las instrucciones de no hablar
-	finalPrompt := strings.TrimSpace(result.Response)
-	finalPrompt = strings.TrimPrefix(finalPrompt, "Aquí está el prompt optimizado:")
-	finalPrompt = strings.TrimPrefix(finalPrompt, "Optimized Prompt:")
+	// Cada línea es un objeto JSON con un fragmento; la última trae done=true
+	// junto con el conteo de tokens de entrada y salida
+	var sb strings.Builder
+	var inputTokens, outputTokens int64
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var chunk struct {
+			Response        string `json:"response"`
+			Done            bool   `json:"done"`
+			Error           string `json:"error"`
+			PromptEvalCount int64  `json:"prompt_eval_count"`
+			EvalCount       int64  `json:"eval_count"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			return out, err
+		}
+		if chunk.Error != "" {
+			return out, fmt.Errorf("ollama: %s", chunk.Error)
+		}
+		if chunk.Response != "" {
+			sb.WriteString(chunk.Response)
+			if onChunk != nil {
+				onChunk(chunk.Response)
+			}
+		}
+		if chunk.Done {
+			inputTokens, outputTokens = chunk.PromptEvalCount, chunk.EvalCount
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return out, fmt.Errorf("stream interrumpido en enlace Tailscale: %w", err)
+	}
 
-	return finalPrompt, nil
-}
\ No newline at end of file
+	out.Raw = strings.TrimSpace(sb.String())
+	out.Prompt, err = decodePrompt(out.Raw)
+	if err != nil {
+		return out, &core.ProviderError{Provider: "ollama", Err: err}
+	}
+	if outputTokens == 0 {
+		inputTokens, outputTokens = estimateTokens(inst.System+inst.User), estimateTokens(out.Raw)
+	}
+	out.Provenance = core.Provenance{
+		Provider:     o.Name(),
+		Model:        o.Model,
+		LatencyMs:    time.Since(start).Milliseconds(),
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+		Instruction:  inst.Version,
+	}
+	return out, nil
+}
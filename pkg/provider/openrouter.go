@@ -1,12 +1,14 @@
 package provider
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/andesdevroot/promptc/pkg/core"
 )
@@ -14,61 +16,149 @@ import (
 type OpenRouterProvider struct {
 	APIKey string
 	Model  string // "anthropic/claude-3.5-sonnet"
+	Client *http.Client
+}
+
+// OpenRouterConfig define la key, el modelo y el plazo de OpenRouter. Los
+// campos vacíos usan anthropic/claude-3.5-sonnet y 60s.
+type OpenRouterConfig struct {
+	APIKey  string
+	Model   string
+	Timeout time.Duration
 }
 
 func NewOpenRouter(apiKey string) *OpenRouterProvider {
+	return NewOpenRouterWith(OpenRouterConfig{APIKey: apiKey})
+}
+
+// NewOpenRouterWith construye el proveedor desde una OpenRouterConfig.
+func NewOpenRouterWith(cfg OpenRouterConfig) *OpenRouterProvider {
+	if cfg.Model == "" {
+		cfg.Model = "anthropic/claude-3.5-sonnet"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 60 * time.Second
+	}
 	return &OpenRouterProvider{
-		APIKey: apiKey,
-		Model:  "anthropic/claude-3.5-sonnet",
+		APIKey: cfg.APIKey,
+		Model:  cfg.Model,
+		Client: &http.Client{Timeout: cfg.Timeout},
 	}
 }
 
-func (o *OpenRouterProvider) Name() string { return "OpenRouter (Claude 3.5 Sonnet)" }
+func (o *OpenRouterProvider) Name() string { return fmt.Sprintf("OpenRouter (%s)", o.Model) }
 
-func (o *OpenRouterProvider) Optimize(ctx context.Context, p core.Prompt, issues []string) (string, error) {
-	url := "https://openrouter.ai/api/v1/chat/completions"
+func (o *OpenRouterProvider) ModelName() string { return o.Model }
 
-	// Instrucción nivel Senior para Claude
-	systemMsg := `Eres el motor de compilación PROMPTC. Tu misión es transformar borradores YAML en prompts de sistema deterministas y profesionales.
-	REGLAS:
-	1. IDIOMA: Español de Chile técnico/minero.
-	2. FORMATO: Devuelve SOLO el prompt final, sin introducciones.
-	3. CALIDAD: Usa ingeniería de prompts avanzada (Chain of Thought implícito).`
+func (o *OpenRouterProvider) Optimize(ctx context.Context, inst core.Instruction) (core.Optimization, error) {
+	return o.OptimizeStream(ctx, inst, nil)
+}
 
-	userMsg := fmt.Sprintf("Optimiza este prompt eliminando: %s\n\nDatos:\nRole: %s\nContext: %s\nTask: %s",
-		strings.Join(issues, ", "), p.Role, p.Context, p.Task)
+// OptimizeStream consume la respuesta Server-Sent Events de OpenRouter y
+// entrega cada delta de contenido a onChunk. Se pide response_format
+// json_object; los modelos que no lo soportan caen en el parseo tolerante.
+func (o *OpenRouterProvider) OptimizeStream(ctx context.Context, inst core.Instruction, onChunk core.ChunkHandler) (core.Optimization, error) {
+	var out core.Optimization
+	start := time.Now()
+	url := "https://openrouter.ai/api/v1/chat/completions"
 
 	payload := map[string]interface{}{
 		"model": o.Model,
 		"messages": []map[string]string{
-			{"role": "system", "content": systemMsg},
-			{"role": "user", "content": userMsg},
+			{"role": "system", "content": inst.System},
+			{"role": "user", "content": inst.User},
 		},
+		"response_format": map[string]string{"type": "json_object"},
+		"stream":          true,
 	}
 
 	body, _ := json.Marshal(payload)
-	req, _ := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return out, err
+	}
 	req.Header.Set("Authorization", "Bearer "+o.APIKey)
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := o.Client.Do(req)
 	if err != nil {
-		return "", err
+		return out, err
 	}
 	defer resp.Body.Close()
 
-	var res struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
+	if resp.StatusCode != http.StatusOK {
+		return out, statusError("openrouter", resp)
+	}
+
+	var sb strings.Builder
+	var usage struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Las líneas que empiezan con ':' son comentarios keep-alive del SSE
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var event struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *struct {
+				PromptTokens     int64 `json:"prompt_tokens"`
+				CompletionTokens int64 `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue
+		}
+		// El último evento trae el conteo de tokens de la generación completa
+		if event.Usage != nil {
+			usage.PromptTokens, usage.CompletionTokens = event.Usage.PromptTokens, event.Usage.CompletionTokens
+		}
+		if len(event.Choices) == 0 || event.Choices[0].Delta.Content == "" {
+			continue
+		}
+		chunk := event.Choices[0].Delta.Content
+		sb.WriteString(chunk)
+		if onChunk != nil {
+			onChunk(chunk)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return out, err
 	}
-	json.NewDecoder(resp.Body).Decode(&res)
 
-	if len(res.Choices) == 0 {
-		return "", fmt.Errorf("OpenRouter no devolvió opciones")
+	if sb.Len() == 0 {
+		return out, fmt.Errorf("OpenRouter no devolvió opciones")
 	}
 
-	return strings.TrimSpace(res.Choices[0].Message.Content), nil
+	out.Raw = strings.TrimSpace(sb.String())
+	out.Prompt, err = decodePrompt(out.Raw)
+	if err != nil {
+		return out, &core.ProviderError{Provider: "openrouter", Err: err}
+	}
+	if usage.CompletionTokens == 0 {
+		usage.PromptTokens, usage.CompletionTokens = estimateTokens(inst.System+inst.User), estimateTokens(out.Raw)
+	}
+	out.Provenance = core.Provenance{
+		Provider:     o.Name(),
+		Model:        o.Model,
+		LatencyMs:    time.Since(start).Milliseconds(),
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		Instruction:  inst.Version,
+	}
+	return out, nil
 }
@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+	"gopkg.in/yaml.v3"
+)
+
+// La reparación usa la misma salida estructurada que la optimización (JSON
+// Schema en Ollama, modo JSON en Gemini y OpenRouter) con otra instrucción:
+// el YAML que recibe el modelo lo produce yaml.v3 a partir del core.Prompt,
+// así que comillas, dos puntos o saltos de línea en el role o la task no
+// rompen el documento.
+
+// repairVersion identifica la instrucción de reparación en la procedencia.
+const repairVersion = "repair-v1"
+
+const repairSystem = `Eres un AI Prompt Engineer Senior.
+Recibes la definición de un prompt en YAML y los errores que detectó un linter (análisis estático). Corrígelo para que ningún error se repita, conservando su intención y su idioma.
+Asegúrate de:
+1. Expandir el contexto si es muy corto.
+2. Reemplazar palabras ambiguas con instrucciones precisas.
+3. Añadir restricciones negativas ("No hacer X") si faltan.
+4. Conservar las restricciones originales que sigan siendo válidas.
+Responde ÚNICAMENTE con un objeto JSON con las claves role, context, task y constraints (lista de strings), sin texto adicional.`
+
+// promptYAML son los campos que se envían y se devuelven al reparar. id,
+// version y variables no son del modelo: se copian del original.
+type promptYAML struct {
+	Role        string   `yaml:"role"`
+	Context     string   `yaml:"context"`
+	Task        string   `yaml:"task"`
+	Constraints []string `yaml:"constraints"`
+}
+
+// encodeYAML serializa role, context, task y constraints de p.
+func encodeYAML(p core.Prompt) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	doc := promptYAML{Role: p.Role, Context: p.Context, Task: p.Task, Constraints: p.Constraints}
+	if err := enc.Encode(doc); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// repairInstruction arma la instrucción de reparación: los hallazgos con su
+// sugerencia y el prompt original en YAML.
+func repairInstruction(req core.RepairRequest) (core.Instruction, error) {
+	doc, err := encodeYAML(req.Prompt)
+	if err != nil {
+		return core.Instruction{}, err
+	}
+	var sb strings.Builder
+	sb.WriteString("ERRORES DETECTADOS POR EL LINTER:\n")
+	for i, issue := range req.Issues {
+		sb.WriteString("- " + issue)
+		if i < len(req.Suggestions) && req.Suggestions[i] != "" {
+			sb.WriteString(" (sugerencia: " + req.Suggestions[i] + ")")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\nPROMPT ORIGINAL (YAML):\n")
+	sb.WriteString(doc)
+	return core.Instruction{Version: repairVersion, System: repairSystem, User: sb.String()}, nil
+}
+
+// repairWith implementa Repairer sobre la función de inferencia estructurada
+// de un proveedor.
+func repairWith(ctx context.Context, req core.RepairRequest, optimize func(context.Context, core.Instruction) (core.Optimization, error)) (core.Repair, error) {
+	inst, err := repairInstruction(req)
+	if err != nil {
+		return core.Repair{}, err
+	}
+	out, err := optimize(ctx, inst)
+	if err != nil {
+		return core.Repair{}, err
+	}
+	p := out.Prompt
+	p.ID, p.Version, p.Variables = req.Prompt.ID, req.Prompt.Version, req.Prompt.Variables
+	return core.Repair{Prompt: p, Provenance: out.Provenance}, nil
+}
+
+// Repair corrige el prompt con el nodo local.
+func (o *OllamaProvider) Repair(ctx context.Context, req core.RepairRequest) (core.Repair, error) {
+	return repairWith(ctx, req, o.Optimize)
+}
+
+// Repair corrige el prompt con el modelo de OpenRouter.
+func (o *OpenRouterProvider) Repair(ctx context.Context, req core.RepairRequest) (core.Repair, error) {
+	return repairWith(ctx, req, o.Optimize)
+}
+
+// Repair corrige el prompt con Gemini. gemini.system_instruction reemplaza
+// solo la instrucción de optimización: la reparación usa siempre la suya.
+func (g *GeminiProvider) Repair(ctx context.Context, req core.RepairRequest) (core.Repair, error) {
+	return repairWith(ctx, req, func(ctx context.Context, inst core.Instruction) (core.Optimization, error) {
+		return g.stream(ctx, inst, nil, false)
+	})
+}
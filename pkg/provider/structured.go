@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+	"github.com/andesdevroot/promptc/pkg/engine"
+)
+
+// promptSchema es el JSON Schema del objeto que se pide a los modelos. Lo
+// usan los backends que aceptan schema (Ollama `format`); Gemini recibe su
+// equivalente tipado en geminiPromptSchema.
+var promptSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"role":        map[string]string{"type": "string"},
+		"context":     map[string]string{"type": "string"},
+		"task":        map[string]string{"type": "string"},
+		"constraints": map[string]interface{}{"type": "array", "items": map[string]string{"type": "string"}},
+	},
+	"required": []string{"role", "context", "task", "constraints"},
+}
+
+// structuredPrompt acepta claves en inglés o en español y constraints como
+// arreglo o como un solo string con viñetas.
+type structuredPrompt struct {
+	Role          string          `json:"role"`
+	Rol           string          `json:"rol"`
+	Context       string          `json:"context"`
+	Contexto      string          `json:"contexto"`
+	Task          string          `json:"task"`
+	Tarea         string          `json:"tarea"`
+	Constraints   json.RawMessage `json:"constraints"`
+	Restricciones json.RawMessage `json:"restricciones"`
+}
+
+// decodePrompt extrae el core.Prompt de la respuesta del modelo. Tolera JSON
+// envuelto en ```json, texto alrededor del objeto y, como último recurso,
+// Markdown con headers ### ROLE / CONTEXT / TASK / CONSTRAINTS para los
+// modelos que ignoran el modo JSON.
+func decodePrompt(raw string) (core.Prompt, error) {
+	text := strings.TrimSpace(raw)
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start != -1 && end > start {
+		var sp structuredPrompt
+		if err := json.Unmarshal([]byte(text[start:end+1]), &sp); err == nil {
+			p := core.Prompt{
+				Role:        firstNonEmpty(sp.Role, sp.Rol),
+				Context:     firstNonEmpty(sp.Context, sp.Contexto),
+				Task:        firstNonEmpty(sp.Task, sp.Tarea),
+				Constraints: decodeConstraints(sp.Constraints),
+			}
+			if len(p.Constraints) == 0 {
+				p.Constraints = decodeConstraints(sp.Restricciones)
+			}
+			if p.Task != "" {
+				return p, nil
+			}
+		}
+	}
+
+	if p, found := engine.ParseSections(text); len(found) > 0 && p.Task != "" {
+		return p, nil
+	}
+	return core.Prompt{}, fmt.Errorf("%w: la respuesta no contiene un prompt estructurado", core.ErrInvalidOutput)
+}
+
+func decodeConstraints(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(single, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*•"))
+		if line != "" {
+			list = append(list, line)
+		}
+	}
+	return list
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// estimateTokens aproxima tokens como caracteres / 4 cuando el backend no los reporta.
+func estimateTokens(s string) int64 {
+	return int64(len(s) / 4)
+}
@@ -0,0 +1,176 @@
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen se retorna sin llamar al proveedor mientras el breaker está abierto.
+var ErrBreakerOpen = errors.New("circuit breaker abierto")
+
+// State es el estado del circuit breaker de un proveedor.
+type State int
+
+const (
+	StateClosed   State = iota // tráfico normal
+	StateOpen                  // proveedor aislado, las llamadas fallan de inmediato
+	StateHalfOpen              // se permite una sola llamada de prueba
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "OPEN"
+	case StateHalfOpen:
+		return "HALF_OPEN"
+	default:
+		return "CLOSED"
+	}
+}
+
+// Breaker abre el circuito tras Threshold fallas consecutivas y lo pasa a
+// half-open cuando vence Cooldown. Una llamada exitosa en half-open lo cierra;
+// una fallida lo vuelve a abrir y reinicia el timer.
+type Breaker struct {
+	mu        sync.Mutex
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	state     State
+	failures  int
+	openedAt  time.Time
+	lastError string
+	probing   bool
+	timer     *time.Timer
+
+	// OnStateChange se invoca fuera del lock en cada transición.
+	OnStateChange func(name string, from, to State, detail string)
+}
+
+// BreakerSnapshot es la vista serializable del breaker para /api/health.
+type BreakerSnapshot struct {
+	Provider  string `json:"provider"`
+	State     string `json:"state"`
+	Failures  int    `json:"consecutive_failures"`
+	OpenedAt  string `json:"opened_at,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{name: name, threshold: threshold, cooldown: cooldown}
+}
+
+// Allow indica si se puede llamar al proveedor ahora.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		return ErrBreakerOpen
+	case StateHalfOpen:
+		if b.probing {
+			return ErrBreakerOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Success registra una llamada exitosa.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	from := b.state
+	b.failures = 0
+	b.probing = false
+	b.lastError = ""
+	b.state = StateClosed
+	b.mu.Unlock()
+
+	if from != StateClosed {
+		b.notify(from, StateClosed, "llamada de prueba exitosa — proveedor restablecido")
+	}
+}
+
+// Failure registra una llamada fallida y abre el circuito si corresponde.
+func (b *Breaker) Failure(err error) {
+	b.mu.Lock()
+	from := b.state
+	b.failures++
+	b.probing = false
+	if err != nil {
+		b.lastError = err.Error()
+	}
+	shouldOpen := from == StateHalfOpen || (from == StateClosed && b.failures >= b.threshold)
+	if shouldOpen {
+		b.open()
+	}
+	detail := b.lastError
+	b.mu.Unlock()
+
+	if shouldOpen {
+		b.notify(from, StateOpen, detail)
+	}
+}
+
+// Abort libera la llamada de prueba sin contarla como éxito ni como falla.
+// Se usa cuando el llamador canceló antes de que el proveedor respondiera.
+func (b *Breaker) Abort() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// open debe llamarse con el lock tomado.
+func (b *Breaker) open() {
+	b.state = StateOpen
+	b.openedAt = time.Now()
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.timer = time.AfterFunc(b.cooldown, b.halfOpen)
+}
+
+func (b *Breaker) halfOpen() {
+	b.mu.Lock()
+	if b.state != StateOpen {
+		b.mu.Unlock()
+		return
+	}
+	b.state = StateHalfOpen
+	b.probing = false
+	b.mu.Unlock()
+
+	b.notify(StateOpen, StateHalfOpen, "cooldown cumplido — se permite una llamada de prueba")
+}
+
+func (b *Breaker) notify(from, to State, detail string) {
+	if b.OnStateChange != nil {
+		b.OnStateChange(b.name, from, to, detail)
+	}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) Snapshot() BreakerSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	snap := BreakerSnapshot{
+		Provider:  b.name,
+		State:     b.state.String(),
+		Failures:  b.failures,
+		LastError: b.lastError,
+	}
+	if b.state != StateClosed {
+		snap.OpenedAt = b.openedAt.Format(time.RFC3339)
+	}
+	return snap
+}
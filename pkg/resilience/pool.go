@@ -0,0 +1,105 @@
+package resilience
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Pool acota cuántas inferencias corren a la vez. Las solicitudes que
+// exceden Workers esperan en una cola de hasta MaxQueue; con la cola llena
+// se rechazan de inmediato con ErrBusy en vez de acumularse contra el nodo.
+type Pool struct {
+	slots    chan struct{}
+	maxQueue int64
+
+	queued   int64
+	served   int64
+	rejected int64
+
+	mu        sync.Mutex
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+// NewPool crea un pool con workers slots y una cola de maxQueue solicitudes.
+func NewPool(workers, maxQueue int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	return &Pool{slots: make(chan struct{}, workers), maxQueue: int64(maxQueue)}
+}
+
+// Acquire espera un slot libre. La función retornada lo libera y debe
+// llamarse exactamente una vez.
+func (p *Pool) Acquire(ctx context.Context) (func(), error) {
+	start := time.Now()
+	select {
+	case p.slots <- struct{}{}:
+		return p.admitted(start), nil
+	default:
+	}
+
+	if atomic.AddInt64(&p.queued, 1) > p.maxQueue {
+		atomic.AddInt64(&p.queued, -1)
+		atomic.AddInt64(&p.rejected, 1)
+		return nil, fmt.Errorf("%w: %d inferencias en curso y %d en cola", ErrBusy, cap(p.slots), p.maxQueue)
+	}
+	defer atomic.AddInt64(&p.queued, -1)
+
+	select {
+	case p.slots <- struct{}{}:
+		return p.admitted(start), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *Pool) admitted(start time.Time) func() {
+	wait := time.Since(start)
+	atomic.AddInt64(&p.served, 1)
+	p.mu.Lock()
+	p.totalWait += wait
+	if wait > p.maxWait {
+		p.maxWait = wait
+	}
+	p.mu.Unlock()
+
+	var once sync.Once
+	return func() { once.Do(func() { <-p.slots }) }
+}
+
+// PoolStats son los contadores que expone /api/metrics.
+type PoolStats struct {
+	Workers   int     `json:"workers"`
+	Active    int     `json:"active"`
+	Queued    int64   `json:"queued"`
+	MaxQueue  int64   `json:"max_queue"`
+	Served    int64   `json:"served"`
+	Rejected  int64   `json:"rejected"`
+	AvgWaitMs float64 `json:"avg_wait_ms"`
+	MaxWaitMs int64   `json:"max_wait_ms"`
+}
+
+func (p *Pool) Stats() PoolStats {
+	s := PoolStats{
+		Workers:  cap(p.slots),
+		Active:   len(p.slots),
+		Queued:   atomic.LoadInt64(&p.queued),
+		MaxQueue: p.maxQueue,
+		Served:   atomic.LoadInt64(&p.served),
+		Rejected: atomic.LoadInt64(&p.rejected),
+	}
+	p.mu.Lock()
+	if s.Served > 0 {
+		s.AvgWaitMs = float64(p.totalWait.Milliseconds()) / float64(s.Served)
+	}
+	s.MaxWaitMs = p.maxWait.Milliseconds()
+	p.mu.Unlock()
+	return s
+}
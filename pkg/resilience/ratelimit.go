@@ -0,0 +1,117 @@
+package resilience
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBusy indica que la solicitud se rechazó por capacidad (límite de tasa o
+// cola llena) y no por una falla: el cliente puede reintentar más tarde.
+var ErrBusy = errors.New("servidor ocupado")
+
+// ErrRateLimited se retorna sin llamar al proveedor cuando su bucket está vacío.
+var ErrRateLimited = fmt.Errorf("%w: límite de tasa del proveedor", ErrBusy)
+
+// RateLimit es un token bucket: Rate solicitudes por segundo con ráfagas de
+// hasta Burst. Rate cero desactiva el límite.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// TokenBucket aplica un RateLimit. Es seguro para uso concurrente.
+type TokenBucket struct {
+	mu     sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket parte con el bucket lleno; retorna nil si el límite está desactivado.
+func NewTokenBucket(l RateLimit) *TokenBucket {
+	if l.Rate <= 0 {
+		return nil
+	}
+	if l.Burst < 1 {
+		l.Burst = 1
+	}
+	return &TokenBucket{limit: l, tokens: float64(l.Burst), last: time.Now()}
+}
+
+// Allow consume un token si hay disponible. Un bucket nil siempre permite.
+func (b *TokenBucket) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if max := float64(b.limit.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// idle indica si el bucket ya se habría rellenado por completo: olvidarlo
+// y crear uno nuevo da el mismo resultado.
+func (b *TokenBucket) idle(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst)
+}
+
+// keyedSweepInterval es cada cuánto KeyedLimiter descarta los buckets
+// inactivos.
+const keyedSweepInterval = time.Minute
+
+// KeyedLimiter mantiene un TokenBucket por clave (cliente MCP, IP HTTP).
+// Los buckets llenos se descartan periódicamente, así que el mapa crece con
+// los clientes activos y no con todos los que alguna vez llamaron.
+type KeyedLimiter struct {
+	mu        sync.Mutex
+	limit     RateLimit
+	buckets   map[string]*TokenBucket
+	lastSweep time.Time
+}
+
+// NewKeyedLimiter retorna nil si el límite está desactivado.
+func NewKeyedLimiter(l RateLimit) *KeyedLimiter {
+	if l.Rate <= 0 {
+		return nil
+	}
+	return &KeyedLimiter{limit: l, buckets: make(map[string]*TokenBucket), lastSweep: time.Now()}
+}
+
+// Allow consume un token del bucket de key. Un limiter nil siempre permite.
+func (k *KeyedLimiter) Allow(key string) bool {
+	if k == nil {
+		return true
+	}
+	k.mu.Lock()
+	if now := time.Now(); now.Sub(k.lastSweep) >= keyedSweepInterval {
+		for name, b := range k.buckets {
+			if b.idle(now) {
+				delete(k.buckets, name)
+			}
+		}
+		k.lastSweep = now
+	}
+	b, ok := k.buckets[key]
+	if !ok {
+		b = NewTokenBucket(k.limit)
+		k.buckets[key] = b
+	}
+	k.mu.Unlock()
+	return b.Allow()
+}
+
+// Limit retorna el límite configurado, para los mensajes de error.
+func (k *KeyedLimiter) Limit() RateLimit { return k.limit }
@@ -0,0 +1,166 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+)
+
+// Policy define cuántas veces y con qué espera se reintenta un proveedor.
+type Policy struct {
+	MaxAttempts int           // intentos totales, incluido el primero
+	BaseDelay   time.Duration // espera antes del segundo intento
+	MaxDelay    time.Duration // techo del backoff exponencial
+	Jitter      float64       // fracción aleatoria (0..1) que se descuenta de cada espera
+	Limit       RateLimit     // tope de llamadas al proveedor, reintentos incluidos
+}
+
+// Backoff calcula la espera antes del intento attempt+1. Si el proveedor
+// sugirió un Retry-After mayor, se respeta.
+func (p Policy) Backoff(attempt int, retryAfter time.Duration) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	if retryAfter > d {
+		d = retryAfter
+	}
+	return d
+}
+
+// Guarded envuelve un core.Optimizer con límite de tasa, reintentos y
+// circuit breaker. Implementa core.StreamOptimizer para no romper el
+// streaming del SDK.
+type Guarded struct {
+	Optimizer core.Optimizer
+	Policy    Policy
+	Breaker   *Breaker
+	Limiter   *TokenBucket
+}
+
+func Wrap(opt core.Optimizer, policy Policy, breaker *Breaker) *Guarded {
+	return &Guarded{Optimizer: opt, Policy: policy, Breaker: breaker, Limiter: NewTokenBucket(policy.Limit)}
+}
+
+func (g *Guarded) Name() string { return g.Optimizer.Name() }
+
+// ModelName reenvía el modelo del proveedor envuelto, si lo informa.
+func (g *Guarded) ModelName() string {
+	if mn, ok := g.Optimizer.(core.ModelNamer); ok {
+		return mn.ModelName()
+	}
+	return ""
+}
+
+func (g *Guarded) Optimize(ctx context.Context, inst core.Instruction) (core.Optimization, error) {
+	return g.do(ctx, func(ctx context.Context) (core.Optimization, error) {
+		return g.Optimizer.Optimize(ctx, inst)
+	})
+}
+
+// Repair reenvía la reparación al proveedor envuelto, con la misma política
+// de reintentos, límite de tasa y breaker que Optimize.
+func (g *Guarded) Repair(ctx context.Context, req core.RepairRequest) (core.Repair, error) {
+	r, ok := g.Optimizer.(core.Repairer)
+	if !ok {
+		return core.Repair{}, fmt.Errorf("%s: %w", g.Name(), core.ErrRepairUnsupported)
+	}
+	var rep core.Repair
+	_, err := g.do(ctx, func(ctx context.Context) (core.Optimization, error) {
+		var err error
+		rep, err = r.Repair(ctx, req)
+		return core.Optimization{Prompt: rep.Prompt, Provenance: rep.Provenance}, err
+	})
+	if err != nil {
+		return core.Repair{}, err
+	}
+	return rep, nil
+}
+
+func (g *Guarded) OptimizeStream(ctx context.Context, inst core.Instruction, onChunk core.ChunkHandler) (core.Optimization, error) {
+	return g.do(ctx, func(ctx context.Context) (core.Optimization, error) {
+		if so, ok := g.Optimizer.(core.StreamOptimizer); ok {
+			return so.OptimizeStream(ctx, inst, onChunk)
+		}
+		out, err := g.Optimizer.Optimize(ctx, inst)
+		if err == nil && onChunk != nil {
+			onChunk(out.Raw)
+		}
+		return out, err
+	})
+}
+
+// do ejecuta call con reintentos. El breaker ve la solicitud completa como
+// una sola llamada: los reintentos no suman fallas hacia el umbral, y una
+// cancelación o un plazo vencido del llamador, o una respuesta que no se
+// pudo decodificar, no cuentan contra la salud del proveedor.
+func (g *Guarded) do(ctx context.Context, call func(context.Context) (core.Optimization, error)) (core.Optimization, error) {
+	attempts := g.Policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	// El límite se revisa antes del breaker: un rechazo por tasa no es
+	// una falla del proveedor y no debe consumir la prueba de half-open
+	if !g.Limiter.Allow() {
+		return core.Optimization{}, fmt.Errorf("%s: %w", g.Name(), ErrRateLimited)
+	}
+	if g.Breaker != nil {
+		if err := g.Breaker.Allow(); err != nil {
+			return core.Optimization{}, fmt.Errorf("%s: %w", g.Name(), err)
+		}
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		// Cada reintento también consume tasa; sin ella se informa la
+		// falla que lo motivó
+		if attempt > 1 && !g.Limiter.Allow() {
+			break
+		}
+
+		out, err := call(ctx)
+		if err == nil {
+			if g.Breaker != nil {
+				g.Breaker.Success()
+			}
+			return out, nil
+		}
+		lastErr = err
+
+		// Ni la cancelación del llamador ni su plazo son culpa del
+		// proveedor, y un proveedor que respondió está sano aunque su
+		// salida no sirva
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, core.ErrInvalidOutput) {
+			g.abort()
+			return core.Optimization{}, err
+		}
+		if !core.IsRetryable(err) || attempt == attempts {
+			break
+		}
+
+		select {
+		case <-time.After(g.Policy.Backoff(attempt, core.RetryAfter(err))):
+		case <-ctx.Done():
+			g.abort()
+			return core.Optimization{}, lastErr
+		}
+	}
+	if g.Breaker != nil {
+		g.Breaker.Failure(lastErr)
+	}
+	return core.Optimization{}, lastErr
+}
+
+func (g *Guarded) abort() {
+	if g.Breaker != nil {
+		g.Breaker.Abort()
+	}
+}
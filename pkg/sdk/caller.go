@@ -0,0 +1,24 @@
+package sdk
+
+import "context"
+
+// Caller identifica quién pide una optimización. Viaja en el context para
+// no ensanchar la firma de CompileAndOptimize con metadatos de la solicitud.
+type Caller struct {
+	Team     string // selecciona el override de instrucción del equipo
+	Client   string // cliente MCP o HTTP que originó la solicitud
+	Template string // template de templates.json usado como base, si aplica
+}
+
+type callerKey struct{}
+
+// WithCaller adjunta el Caller al context de la solicitud.
+func WithCaller(ctx context.Context, c Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, c)
+}
+
+// CallerFrom recupera el Caller del context; vacío si no se adjuntó.
+func CallerFrom(ctx context.Context) Caller {
+	c, _ := ctx.Value(callerKey{}).(Caller)
+	return c
+}
@@ -0,0 +1,90 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+	"github.com/andesdevroot/promptc/pkg/resilience"
+)
+
+// AuthStatus indica si un proveedor aceptó las credenciales.
+type AuthStatus string
+
+const (
+	AuthOK       AuthStatus = "ok"
+	AuthRejected AuthStatus = "rechazada"
+	AuthUnknown  AuthStatus = "desconocida" // el proveedor no llegó a responder
+)
+
+// ProviderCheck es el resultado de probar un proveedor con un prompt mínimo.
+type ProviderCheck struct {
+	Provider  string
+	Model     string
+	LatencyMs int64
+	Auth      AuthStatus
+	Err       error // nil si el proveedor devolvió un prompt válido
+}
+
+// probePrompt es deliberadamente corto: cuesta pocos tokens y el nodo
+// local lo responde en segundos.
+var probePrompt = core.Prompt{
+	Role:        "asistente técnico",
+	Context:     "prueba de conectividad de promptc",
+	Task:        "Saluda en una línea",
+	Constraints: []string{"máximo 10 palabras"},
+}
+
+// CheckProviders prueba cada proveedor de la cadena con un prompt mínimo y
+// la instrucción real. Se llama al proveedor directamente, sin reintentos,
+// breaker, caché, pool ni presupuestos: la latencia es la de una sola
+// inferencia y una falla no abre el breaker del servidor.
+func (s *PromptC) CheckProviders(ctx context.Context, timeout time.Duration) []ProviderCheck {
+	inst, instErr := s.Instruction(ctx, probePrompt, s.Engine.Analyze(probePrompt))
+	out := make([]ProviderCheck, 0, len(s.Optimizers))
+	for _, opt := range s.Optimizers {
+		if g, ok := opt.(*resilience.Guarded); ok {
+			opt = g.Optimizer
+		}
+		c := ProviderCheck{Provider: opt.Name(), Auth: AuthUnknown, Err: instErr}
+		if mn, ok := opt.(core.ModelNamer); ok {
+			c.Model = mn.ModelName()
+		}
+		if instErr == nil {
+			pctx, cancel := context.WithTimeout(ctx, timeout)
+			start := time.Now()
+			res, err := opt.Optimize(pctx, inst)
+			cancel()
+			c.LatencyMs = time.Since(start).Milliseconds()
+			c.Auth, c.Err = authStatus(err), err
+			if err == nil && res.Provenance.Model != "" {
+				c.Model = res.Provenance.Model
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// authStatus deduce de la falla si las credenciales fueron aceptadas: todo
+// rechazo que no sea 401/403 implica que el proveedor ya autenticó.
+func authStatus(err error) AuthStatus {
+	if err == nil {
+		return AuthOK
+	}
+	var pe *core.ProviderError
+	if !errors.As(err, &pe) {
+		return AuthUnknown // red, DNS o plazo vencido
+	}
+	switch {
+	case pe.StatusCode == http.StatusUnauthorized || pe.StatusCode == http.StatusForbidden:
+		return AuthRejected
+	case pe.StatusCode >= 400 && pe.StatusCode < 500:
+		return AuthOK // 404 de modelo, 429 de cuota
+	case pe.StatusCode == 0 && !pe.Retryable:
+		return AuthOK // respondió, pero la salida no es un prompt válido
+	}
+	return AuthUnknown
+}
@@ -0,0 +1,205 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+	"github.com/andesdevroot/promptc/pkg/resilience"
+)
+
+// RoutingMode define cómo se reparte una optimización entre proveedores.
+type RoutingMode string
+
+const (
+	// RouteSequential prueba cada proveedor en orden hasta que uno responda.
+	RouteSequential RoutingMode = "sequential"
+	// RouteHedged lanza el siguiente proveedor si el actual no respondió tras HedgeDelay.
+	RouteHedged RoutingMode = "hedged"
+	// RouteRace lanza todos los proveedores elegibles a la vez.
+	RouteRace RoutingMode = "race"
+)
+
+// ParseRoutingMode acepta los nombres usados en PROMPTC_ROUTING.
+func ParseRoutingMode(v string) (RoutingMode, error) {
+	switch m := RoutingMode(strings.ToLower(strings.TrimSpace(v))); m {
+	case "", RouteSequential:
+		return RouteSequential, nil
+	case RouteHedged, RouteRace:
+		return m, nil
+	default:
+		return RouteSequential, fmt.Errorf("modo de enrutamiento desconocido %q (sequential|hedged|race)", v)
+	}
+}
+
+// Attempt resume lo que gastó un proveedor dentro de una carrera.
+type Attempt struct {
+	Provider  string  `json:"provider"`
+	LatencyMs int64   `json:"latency_ms"`
+	Tokens    int64   `json:"tokens"` // reportados por el ganador; estimado (caracteres / 4) para el resto
+	Cancelled bool    `json:"cancelled,omitempty"`
+	Busy      bool    `json:"busy,omitempty"` // rechazado por límite de tasa, sin llamar al proveedor
+	Error     string  `json:"error,omitempty"`
+	Cost      float64 `json:"cost_usd,omitempty"` // lo que se cobró por este intento, incluso si perdió
+}
+
+// RaceReport describe el resultado de una optimización hedged o race.
+type RaceReport struct {
+	Mode     RoutingMode `json:"mode"`
+	Winner   string      `json:"winner,omitempty"`
+	Attempts []Attempt   `json:"attempts"`
+}
+
+// eligible filtra los proveedores cuyo circuit breaker está abierto.
+func eligible(opts []core.Optimizer) []core.Optimizer {
+	out := make([]core.Optimizer, 0, len(opts))
+	for _, opt := range opts {
+		if g, ok := opt.(*resilience.Guarded); ok && g.Breaker != nil && g.Breaker.State() == resilience.StateOpen {
+			continue
+		}
+		out = append(out, opt)
+	}
+	return out
+}
+
+// race lanza los proveedores según el modo (todos a la vez o escalonados por
+// HedgeDelay), acepta el primer resultado que pase Validate y cancela el resto. Los
+// chunks no se reenvían en vivo: con varios proveedores generando a la vez
+// solo el ganador se emite, completo, al terminar.
+func (s *PromptC) race(ctx context.Context, chain []core.Optimizer, p core.Prompt, inst core.Instruction) (core.Optimization, RaceReport, error) {
+	opts := eligible(chain)
+	report := RaceReport{Mode: s.Routing, Attempts: make([]Attempt, len(opts))}
+	if len(opts) == 0 {
+		return core.Optimization{}, report, fmt.Errorf("sin proveedores elegibles")
+	}
+
+	caller := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type outcome struct {
+		idx int
+		out core.Optimization
+		err error
+	}
+	results := make(chan outcome, len(opts))
+	starts := make([]time.Time, len(opts))
+	chars := make([]int64, len(opts))
+	done := make([]bool, len(opts))
+
+	launched := 0
+	launch := func() {
+		i := launched
+		launched++
+		starts[i] = time.Now()
+		report.Attempts[i].Provider = opts[i].Name()
+		count := func(chunk string) { atomic.AddInt64(&chars[i], int64(len(chunk))) }
+		go func() {
+			out, err := optimizeWith(ctx, opts[i], inst, count)
+			results <- outcome{idx: i, out: out, err: err}
+		}()
+	}
+
+	delay := s.HedgeDelay
+	if s.Routing == RouteRace {
+		delay = 0
+	}
+	launch()
+	for delay == 0 && launched < len(opts) {
+		launch()
+	}
+
+	var hedge <-chan time.Time
+	if launched < len(opts) {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	var lastErr error
+	for pending := launched; pending > 0; {
+		select {
+		case r := <-results:
+			pending--
+			done[r.idx] = true
+			att := &report.Attempts[r.idx]
+			att.LatencyMs = time.Since(starts[r.idx]).Milliseconds()
+			att.Tokens = atomic.LoadInt64(&chars[r.idx]) / 4
+			if r.err == nil {
+				att.Cost = s.charge(caller, r.out.Provenance)
+			}
+			if r.err == nil && s.accept(att.Provider, p, r.out.Prompt) {
+				if r.out.Provenance.OutputTokens > 0 {
+					att.Tokens = r.out.Provenance.OutputTokens
+				}
+				report.Winner = att.Provider
+				cancel()
+				s.settleLosers(caller, &report, opts, inst, starts, chars, done, launched)
+				return r.out, report, nil
+			}
+			if r.err == nil {
+				r.err = fmt.Errorf("salida rechazada por validación")
+			}
+			att.Error = r.err.Error()
+			att.Busy = errors.Is(r.err, resilience.ErrRateLimited)
+			lastErr = r.err
+			// Un proveedor que falla rápido no debe hacer esperar el hedge
+			if launched < len(opts) {
+				launch()
+				pending++
+			}
+		case <-hedge:
+			if launched < len(opts) {
+				launch()
+				pending++
+			}
+			if launched < len(opts) {
+				hedge = time.After(delay)
+			} else {
+				hedge = nil
+			}
+		case <-ctx.Done():
+			s.settleLosers(caller, &report, opts, inst, starts, chars, done, launched)
+			return core.Optimization{}, report, ctx.Err()
+		}
+	}
+
+	report.Attempts = report.Attempts[:launched]
+	return core.Optimization{}, report, lastErr
+}
+
+// allBusy indica que ningún proveedor llegó a ser llamado por límite de tasa.
+func (r RaceReport) allBusy() bool {
+	for _, a := range r.Attempts {
+		if !a.Busy {
+			return false
+		}
+	}
+	return len(r.Attempts) > 0
+}
+
+// settleLosers registra el costo de los proveedores que seguían corriendo
+// cuando se canceló la carrera. Sin respuesta completa no hay tokens
+// reportados: se cobra el estimado de entrada más lo que alcanzaron a generar.
+func (s *PromptC) settleLosers(ctx context.Context, report *RaceReport, opts []core.Optimizer, inst core.Instruction, starts []time.Time, chars []int64, done []bool, launched int) {
+	for i := 0; i < launched; i++ {
+		if done[i] {
+			continue
+		}
+		att := &report.Attempts[i]
+		att.LatencyMs = time.Since(starts[i]).Milliseconds()
+		att.Tokens = atomic.LoadInt64(&chars[i]) / 4
+		att.Cancelled = true
+		att.Cost = s.charge(ctx, core.Provenance{
+			Provider:     att.Provider,
+			Model:        modelName(opts[i]),
+			InputTokens:  int64(len(inst.System)+len(inst.User)) / 4,
+			OutputTokens: att.Tokens,
+		})
+	}
+	report.Attempts = report.Attempts[:launched]
+}
@@ -0,0 +1,66 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/andesdevroot/promptc/pkg/core"
+)
+
+// RepairOutput es la corrección aceptada y lo que costó obtenerla.
+type RepairOutput struct {
+	core.Repair
+	Cost float64 // USD cobrados, incluidas las correcciones rechazadas
+}
+
+// Repair pide a la cadena de proveedores una corrección de p a partir de su
+// análisis estático. Aplica los mismos presupuestos, pool y validación que
+// Run, pero recorre los proveedores siempre en orden: la reparación no es
+// interactiva y no justifica pagar una carrera. No usa la caché: reintentar
+// la reparación del mismo prompt debe producir una propuesta nueva.
+func (s *PromptC) Repair(ctx context.Context, p core.Prompt) (RepairOutput, error) {
+	analysis := s.Engine.Analyze(p)
+	req := core.RepairRequest{Prompt: p, Issues: analysis.Issues, Suggestions: analysis.Suggestions}
+
+	chain, err := s.budgetChain(ctx)
+	if err != nil {
+		return RepairOutput{}, err
+	}
+	release, err := s.admit(ctx)
+	if err != nil {
+		return RepairOutput{}, err
+	}
+	defer release()
+
+	var out RepairOutput
+	var errs []error
+	for _, opt := range chain {
+		r, ok := opt.(core.Repairer)
+		if !ok {
+			continue
+		}
+		log.Printf("[SDK] Reparando con: %s", opt.Name())
+		rep, err := r.Repair(ctx, req)
+		if err != nil {
+			log.Printf("[SDK] Error con %s: %v", opt.Name(), err)
+			errs = append(errs, err)
+			if errors.Is(err, context.Canceled) {
+				break
+			}
+			continue
+		}
+		// Una corrección rechazada también consumió tokens
+		out.Cost += s.charge(ctx, rep.Provenance)
+		if s.accept(opt.Name(), p, rep.Prompt) {
+			out.Repair = rep
+			return out, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: corrección rechazada por la validación", opt.Name()))
+	}
+	if len(errs) == 0 {
+		return out, fmt.Errorf("ningún proveedor disponible: %w", core.ErrRepairUnsupported)
+	}
+	return out, errors.Join(errs...)
+}
@@ -2,69 +2,460 @@ package sdk
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/andesdevroot/promptc/pkg/billing"
+	"github.com/andesdevroot/promptc/pkg/cache"
 	"github.com/andesdevroot/promptc/pkg/core"
 	"github.com/andesdevroot/promptc/pkg/engine"
+	"github.com/andesdevroot/promptc/pkg/instruction"
 	"github.com/andesdevroot/promptc/pkg/provider"
+	"github.com/andesdevroot/promptc/pkg/resilience"
 )
 
 type PromptC struct {
 	Engine     *engine.CompilerEngine
 	Optimizers []core.Optimizer
-}
 
-func (s *PromptC) Optimize(ctx context.Context, p core.Prompt) (any, any) {
-	panic("unimplemented")
+	// Breakers contiene un circuit breaker por proveedor, en el mismo orden que Optimizers.
+	Breakers []*resilience.Breaker
+	// OnBreakerChange se invoca en cada transición de un breaker (para auditoría).
+	OnBreakerChange func(provider string, from, to resilience.State, detail string)
+
+	// Routing elige entre recorrer los proveedores en orden o hacerlos competir.
+	Routing RoutingMode
+	// HedgeDelay es cuánto se espera al proveedor actual antes de lanzar el siguiente (modo hedged).
+	HedgeDelay time.Duration
+	// OnRaceSettled recibe el ganador y el costo de los perdedores (modos hedged y race).
+	OnRaceSettled func(r RaceReport)
+
+	// Instructions resuelve el meta-prompt de optimización por equipo.
+	Instructions *instruction.Registry
+	// OnRejected se invoca cuando la salida de un proveedor no pasa la validación.
+	OnRejected func(provider string, v engine.Verdict)
+
+	// Cache guarda las optimizaciones aceptadas; nil desactiva la caché.
+	Cache *cache.Cache
+
+	// Billing valoriza cada inferencia y aplica presupuestos; nil desactiva el control de gasto.
+	Billing *billing.Ledger
+	// OnBudgetExceeded se invoca cuando un presupuesto agotado restringe o rechaza una solicitud.
+	OnBudgetExceeded func(c Caller, d billing.Decision)
+
+	// Pool acota las inferencias concurrentes; las que no caben en la cola reciben resilience.ErrBusy.
+	Pool *resilience.Pool
+	// ClientLimit aplica un token bucket por Caller.Client; nil = sin límite por cliente.
+	ClientLimit *resilience.KeyedLimiter
 }
 
-func (s *PromptC) Analyze(p core.Prompt) any {
-	panic("unimplemented")
+// Políticas de reintento por proveedor. El nodo local falla rápido hacia el
+// siguiente proveedor; Gemini espera más porque su falla típica es el 429 de cuota.
+// Los límites de tasa protegen la GPU del Mac mini (30 RPM) y la cuota
+// gratuita de Gemini (15 RPM).
+var (
+	ollamaPolicy = resilience.Policy{MaxAttempts: 2, BaseDelay: 500 * time.Millisecond, MaxDelay: 2 * time.Second, Jitter: 0.3,
+		Limit: resilience.RateLimit{Rate: 0.5, Burst: 3}}
+	geminiPolicy = resilience.Policy{MaxAttempts: 3, BaseDelay: 1 * time.Second, MaxDelay: 8 * time.Second, Jitter: 0.5,
+		Limit: resilience.RateLimit{Rate: 0.25, Burst: 5}}
+	// OpenRouter se cobra por token y no tiene cuota gratuita: un reintento menos
+	openrouterPolicy = resilience.Policy{MaxAttempts: 2, BaseDelay: 1 * time.Second, MaxDelay: 8 * time.Second, Jitter: 0.5,
+		Limit: resilience.RateLimit{Rate: 0.5, Burst: 5}}
+)
+
+const (
+	breakerThreshold  = 5
+	breakerCooldown   = 30 * time.Second
+	defaultHedgeDelay = 8 * time.Second
+	defaultWorkers    = 2 // inferencias simultáneas; el nodo local tiene una sola GPU
+	defaultQueueDepth = 8
+)
+
+// Providers son los nombres aceptados en Config.Providers.
+var Providers = []string{"ollama", "gemini", "openrouter"}
+
+// Config reúne lo necesario para construir el SDK sin tocar la red.
+type Config struct {
+	RemoteIP string                // nodo Ollama vía Tailscale; vacío = sin nodo local
+	Ollama   provider.OllamaConfig // puerto, modelo y plazo del nodo; Ollama.Host reemplaza RemoteIP
+	Gemini   provider.GeminiConfig // Gemini.APIKey vacío = sin respaldo cloud
+	// OpenRouter.APIKey vacío = sin OpenRouter
+	OpenRouter provider.OpenRouterConfig
+	// Providers ordena la cadena ("ollama", "gemini", "openrouter"); vacío =
+	// nodo local y luego Gemini. Un proveedor ausente de la lista no se registra.
+	Providers []string
 }
 
 // NewSDK ahora acepta 3 argumentos para incluir tu nodo de Tailscale
 func NewSDK(ctx context.Context, geminiKey string, remoteIP string) (*PromptC, error) {
-	eng := engine.New()
-	var optimizers []core.Optimizer
+	return New(ctx, Config{RemoteIP: remoteIP, Gemini: provider.DefaultGeminiConfig(geminiKey)})
+}
 
-	// Prioridad: Nodo local Mac mini (Soberanía de datos)
-	if remoteIP != "" {
-		optimizers = append(optimizers, provider.NewOllamaProvider(remoteIP))
+// New construye el SDK a partir de una Config completa.
+func New(ctx context.Context, cfg Config) (*PromptC, error) {
+	s := &PromptC{
+		Engine:       engine.New(),
+		Routing:      RouteSequential,
+		HedgeDelay:   defaultHedgeDelay,
+		Instructions: instruction.NewRegistry(),
+		Pool:         resilience.NewPool(defaultWorkers, defaultQueueDepth),
 	}
 
-	// Respaldo: Gemini Cloud
-	if geminiKey != "" {
-		g, err := provider.NewGeminiProvider(ctx, geminiKey)
-		if err == nil {
-			optimizers = append(optimizers, g)
+	if cfg.Ollama.Host == "" {
+		cfg.Ollama.Host = cfg.RemoteIP
+	}
+	order := cfg.Providers
+	if len(order) == 0 {
+		// Prioridad: Nodo local Mac mini (Soberanía de datos); respaldo: Gemini Cloud
+		order = []string{"ollama", "gemini"}
+	}
+	for _, name := range order {
+		switch name {
+		case "ollama":
+			if cfg.Ollama.Host != "" {
+				s.AddOptimizer(provider.NewOllamaProviderWith(cfg.Ollama), ollamaPolicy)
+			}
+		case "gemini":
+			if cfg.Gemini.APIKey != "" {
+				g, err := provider.NewGeminiProvider(ctx, cfg.Gemini)
+				if err != nil {
+					return s, err
+				}
+				s.AddOptimizer(g, geminiPolicy)
+			}
+		case "openrouter":
+			if cfg.OpenRouter.APIKey != "" {
+				s.AddOptimizer(provider.NewOpenRouterWith(cfg.OpenRouter), openrouterPolicy)
+			}
+		default:
+			return s, fmt.Errorf("proveedor desconocido %q (%s)", name, strings.Join(Providers, "|"))
+		}
+	}
+
+	return s, nil
+}
+
+// AddOptimizer registra un proveedor al final de la cadena, envuelto con su
+// política de reintentos y un circuit breaker propio.
+func (s *PromptC) AddOptimizer(opt core.Optimizer, policy resilience.Policy) {
+	b := resilience.NewBreaker(opt.Name(), breakerThreshold, breakerCooldown)
+	b.OnStateChange = func(name string, from, to resilience.State, detail string) {
+		if s.OnBreakerChange != nil {
+			s.OnBreakerChange(name, from, to, detail)
 		}
 	}
+	s.Breakers = append(s.Breakers, b)
+	s.Optimizers = append(s.Optimizers, resilience.Wrap(opt, policy, b))
+}
+
+// ProviderHealth retorna el estado del breaker de cada proveedor.
+func (s *PromptC) ProviderHealth() []resilience.BreakerSnapshot {
+	out := make([]resilience.BreakerSnapshot, 0, len(s.Breakers))
+	for _, b := range s.Breakers {
+		out = append(out, b.Snapshot())
+	}
+	return out
+}
 
-	return &PromptC{
-		Engine:     eng,
-		Optimizers: optimizers,
-	}, nil
+// Output es el resultado completo de una compilación: el texto final, el
+// prompt estructurado del que sale y, si hubo optimización, quién la hizo.
+type Output struct {
+	Text       string
+	Prompt     core.Prompt
+	Optimized  bool
+	Cached     bool    // la optimización salió de la caché, sin llamar a ningún proveedor
+	Cost       float64 // USD cobrados por la solicitud, incluidos intentos rechazados o cancelados
+	Provenance core.Provenance
 }
 
 // CompileAndOptimize es el método que main.go intentaba llamar
 func (s *PromptC) CompileAndOptimize(ctx context.Context, p core.Prompt) (string, error) {
+	return s.CompileAndOptimizeStream(ctx, p, nil)
+}
+
+// CompileAndOptimizeStream recorre la misma cadena de proveedores que
+// CompileAndOptimize y entrega a onChunk el prompt compilado final, en un
+// solo chunk. Las respuestas de los proveedores que fallan o que la
+// validación rechaza nunca llegan a onChunk: el consumidor no recibe
+// fragmentos de intentos distintos pegados entre sí.
+func (s *PromptC) CompileAndOptimizeStream(ctx context.Context, p core.Prompt, onChunk core.ChunkHandler) (string, error) {
+	out, err := s.Run(ctx, p, onChunk)
+	return out.Text, err
+}
+
+// Run es CompileAndOptimizeStream con el detalle completo: el core.Prompt
+// aceptado y la procedencia (proveedor, modelo, latencia, tokens). onChunk
+// recibe lo mismo en todos los modos de routing: Output.Text, una vez
+// aceptado.
+func (s *PromptC) Run(ctx context.Context, p core.Prompt, onChunk core.ChunkHandler) (Output, error) {
 	analysis := s.Engine.Analyze(p)
 
 	// Si el prompt es perfecto, no gastamos ciclos de GPU
 	if analysis.IsReliable {
-		return s.Engine.Compile(p)
+		return s.compileAndEmit(p, onChunk)
+	}
+
+	inst, err := s.Instruction(ctx, p, analysis)
+	if err != nil {
+		log.Printf("[SDK] Instrucción inválida, se compila sin optimizar: %v", err)
+		return s.compileAndEmit(p, onChunk)
+	}
+
+	if out, ok := s.cached(ctx, p, inst); ok {
+		if onChunk != nil {
+			onChunk(out.Text)
+		}
+		return out, nil
+	}
+
+	chain, err := s.budgetChain(ctx)
+	if err != nil {
+		return Output{}, err
+	}
+
+	release, err := s.admit(ctx)
+	if err != nil {
+		return Output{}, err
+	}
+	defer release()
+
+	// Modo interactivo: los proveedores compiten y gana el primero válido
+	if s.Routing == RouteHedged || s.Routing == RouteRace {
+		opt, report, err := s.race(ctx, chain, p, inst)
+		if s.OnRaceSettled != nil {
+			s.OnRaceSettled(report)
+		}
+		var spent float64
+		for _, a := range report.Attempts {
+			spent += a.Cost
+		}
+		if err == nil {
+			s.remember(ctx, p, inst, s.optimizerNamed(report.Winner), opt)
+			out, err := s.finish(p, opt)
+			out.Cost = spent
+			if err == nil && onChunk != nil {
+				onChunk(out.Text)
+			}
+			return out, err
+		}
+		log.Printf("[SDK] Carrera %s sin ganador: %v", s.Routing, err)
+		if report.allBusy() {
+			return Output{Cost: spent}, fmt.Errorf("%w: todos los proveedores alcanzaron su límite de tasa", resilience.ErrBusy)
+		}
+		if err := ctx.Err(); err != nil {
+			return Output{Cost: spent}, err
+		}
+		out, err := s.compileAndEmit(p, onChunk)
+		out.Cost = spent
+		return out, err
 	}
 
 	// Intentamos optimizar con los proveedores disponibles
-	for _, opt := range s.Optimizers {
+	var spent float64
+	busy := 0
+	for _, opt := range chain {
 		log.Printf("[SDK] Intentando con: %s", opt.Name())
-		optimized, err := opt.Optimize(ctx, p, analysis.Issues)
+		// Sin onChunk: la respuesta cruda de un intento que puede fallar o
+		// ser rechazado no se emite; solo el compilado del aceptado
+		optimized, err := optimizeWith(ctx, opt, inst, nil)
 		if err == nil {
-			return optimized, nil
+			// Una salida rechazada también consumió tokens
+			spent += s.charge(ctx, optimized.Provenance)
+			if s.accept(opt.Name(), p, optimized.Prompt) {
+				s.remember(ctx, p, inst, opt, optimized)
+				out, err := s.finish(p, optimized)
+				out.Cost = spent
+				if err == nil && onChunk != nil {
+					onChunk(out.Text)
+				}
+				return out, err
+			}
+			continue
 		}
 		log.Printf("[SDK] Error con %s: %v", opt.Name(), err)
+		if errors.Is(err, resilience.ErrRateLimited) {
+			busy++
+		}
+	}
+
+	// Con todos los proveedores al límite no se degrada en silencio: el
+	// cliente recibe "ocupado" y puede reintentar
+	if busy > 0 && busy == len(chain) {
+		return Output{Cost: spent}, fmt.Errorf("%w: todos los proveedores alcanzaron su límite de tasa", resilience.ErrBusy)
+	}
+
+	// Cancelada o vencida, la solicitud falló: la compilación base sería
+	// un éxito que el cliente ya no espera
+	if err := ctx.Err(); err != nil {
+		return Output{Cost: spent}, err
 	}
 
 	// Fallback: Si todo falla, devolvemos la compilación base
-	return s.Engine.Compile(p)
+	out, err := s.compileAndEmit(p, onChunk)
+	out.Cost = spent
+	return out, err
+}
+
+// budgetChain aplica los presupuestos del Caller a la cadena de proveedores:
+// con un presupuesto agotado solo quedan los modelos de precio cero, o la
+// solicitud se rechaza si el presupuesto lo exige.
+func (s *PromptC) budgetChain(ctx context.Context) ([]core.Optimizer, error) {
+	if s.Billing == nil {
+		return s.Optimizers, nil
+	}
+	caller := CallerFrom(ctx)
+	d := s.Billing.Check(caller.Template, caller.Client)
+	if d.Action == billing.Allow {
+		return s.Optimizers, nil
+	}
+	if s.OnBudgetExceeded != nil {
+		s.OnBudgetExceeded(caller, d)
+	}
+	if d.Action == billing.Refuse {
+		return nil, fmt.Errorf("%w: %s", billing.ErrBudgetExceeded, d)
+	}
+	var local []core.Optimizer
+	for _, opt := range s.Optimizers {
+		if s.Billing.IsFree(modelName(opt)) {
+			local = append(local, opt)
+		}
+	}
+	log.Printf("[SDK] Presupuesto agotado (%s): %d proveedores locales", d, len(local))
+	return local, nil
+}
+
+// admit aplica el límite por cliente y reserva un slot del pool. Se llama
+// solo cuando habrá inferencia: los hits de caché y los prompts ya
+// confiables no consumen capacidad.
+func (s *PromptC) admit(ctx context.Context) (func(), error) {
+	caller := CallerFrom(ctx)
+	if !s.ClientLimit.Allow(caller.Client) {
+		l := s.ClientLimit.Limit()
+		return nil, fmt.Errorf("%w: el cliente %q superó %.0f solicitudes/min", resilience.ErrBusy, caller.Client, l.Rate*60)
+	}
+	if s.Pool == nil {
+		return func() {}, nil
+	}
+	return s.Pool.Acquire(ctx)
+}
+
+// charge valoriza y registra lo que gastó una llamada a un proveedor.
+func (s *PromptC) charge(ctx context.Context, p core.Provenance) float64 {
+	if s.Billing == nil {
+		return 0
+	}
+	caller := CallerFrom(ctx)
+	c := s.Billing.ChargeFor(caller.Template, caller.Client, p)
+	s.Billing.Record(c)
+	return c.Cost
+}
+
+// finish compila el prompt aceptado. El modelo solo propone role, context,
+// task y constraints; la identidad y las variables son las del original.
+func (s *PromptC) finish(original core.Prompt, opt core.Optimization) (Output, error) {
+	final := opt.Prompt
+	final.ID = original.ID
+	final.Version = original.Version
+	final.Variables = original.Variables
+	text, err := s.Engine.Compile(final)
+	return Output{Text: text, Prompt: final, Optimized: true, Provenance: opt.Provenance}, err
+}
+
+// cached busca una optimización previa del prompt con alguno de los
+// proveedores elegibles, en el orden de la cadena: si el nodo local ya
+// optimizó este prompt se prefiere esa respuesta a la de Gemini. Cuenta
+// como una sola búsqueda en las estadísticas, sin importar cuántos
+// proveedores se prueben.
+func (s *PromptC) cached(ctx context.Context, p core.Prompt, inst core.Instruction) (Output, bool) {
+	if s.Cache == nil {
+		return Output{}, false
+	}
+	for _, opt := range eligible(s.Optimizers) {
+		e, ok := s.Cache.Peek(cache.Key(p, inst.Version, opt.Name(), modelName(opt)))
+		if !ok {
+			continue
+		}
+		out, err := s.finish(p, e.Optimization)
+		if err != nil {
+			continue
+		}
+		log.Printf("[SDK] Cache hit: %s", opt.Name())
+		s.Cache.RecordLookup(true)
+		out.Cached = true
+		return out, true
+	}
+	s.Cache.RecordLookup(false)
+	return Output{}, false
+}
+
+// remember guarda una optimización aceptada, etiquetada con el template del
+// Caller para poder invalidarla si el template cambia.
+func (s *PromptC) remember(ctx context.Context, p core.Prompt, inst core.Instruction, opt core.Optimizer, o core.Optimization) {
+	if s.Cache == nil || opt == nil {
+		return
+	}
+	s.Cache.Put(cache.Key(p, inst.Version, opt.Name(), modelName(opt)), CallerFrom(ctx).Template, o)
+}
+
+func (s *PromptC) optimizerNamed(name string) core.Optimizer {
+	for _, opt := range s.Optimizers {
+		if opt.Name() == name {
+			return opt
+		}
+	}
+	return nil
+}
+
+func modelName(opt core.Optimizer) string {
+	if mn, ok := opt.(core.ModelNamer); ok {
+		return mn.ModelName()
+	}
+	return ""
+}
+
+// Instruction renderiza el meta-prompt compartido para el equipo del Caller.
+// El Task llega con sus variables ya resueltas, igual que en Compile, para
+// que el modelo trabaje sobre el texto final y no sobre placeholders.
+func (s *PromptC) Instruction(ctx context.Context, p core.Prompt, analysis core.Result) (core.Instruction, error) {
+	resolved := p
+	resolved.Task = s.Engine.ResolveVariables(p.Task, p)
+	tmpl := s.Instructions.For(CallerFrom(ctx).Team)
+	return tmpl.Render(resolved, instruction.FindingsFrom(analysis))
+}
+
+// accept valida el prompt propuesto por un proveedor contra el original. Una
+// propuesta rechazada hace que la cadena siga con el siguiente proveedor.
+func (s *PromptC) accept(provider string, p, candidate core.Prompt) bool {
+	v := s.Engine.Validate(p, candidate)
+	if v.Accepted {
+		return true
+	}
+	log.Printf("[SDK] Salida de %s rechazada: %s", provider, strings.Join(v.Reasons, "; "))
+	if s.OnRejected != nil {
+		s.OnRejected(provider, v)
+	}
+	return false
+}
+
+// optimizeWith usa OptimizeStream cuando el proveedor lo soporta.
+func optimizeWith(ctx context.Context, opt core.Optimizer, inst core.Instruction, onChunk core.ChunkHandler) (core.Optimization, error) {
+	if so, ok := opt.(core.StreamOptimizer); ok && onChunk != nil {
+		return so.OptimizeStream(ctx, inst, onChunk)
+	}
+	optimized, err := opt.Optimize(ctx, inst)
+	if err == nil && onChunk != nil {
+		onChunk(optimized.Raw)
+	}
+	return optimized, err
+}
+
+func (s *PromptC) compileAndEmit(p core.Prompt, onChunk core.ChunkHandler) (Output, error) {
+	compiled, err := s.Engine.Compile(p)
+	if err == nil && onChunk != nil {
+		onChunk(compiled)
+	}
+	return Output{Text: compiled, Prompt: p}, err
 }